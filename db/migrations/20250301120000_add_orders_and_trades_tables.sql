@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    orders (
+        id SERIAL PRIMARY KEY,
+        asset VARCHAR,
+        source VARCHAR NOT NULL,
+        genome_id INTEGER REFERENCES genomes (id),
+        exchange_id BIGINT,
+        date TIMESTAMP NOT NULL,
+        side VARCHAR NOT NULL,
+        quantity DOUBLE PRECISION NOT NULL,
+        requested_price DOUBLE PRECISION NOT NULL,
+        fill_price DOUBLE PRECISION NOT NULL,
+        fees DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+        status VARCHAR NOT NULL
+    );
+
+CREATE INDEX idx_orders_asset_date ON orders (asset, date);
+
+CREATE TABLE
+    trades (
+        id SERIAL PRIMARY KEY,
+        asset VARCHAR,
+        source VARCHAR NOT NULL,
+        genome_id INTEGER REFERENCES genomes (id),
+        side VARCHAR NOT NULL,
+        quantity DOUBLE PRECISION NOT NULL,
+        entry_time TIMESTAMP NOT NULL,
+        entry_price DOUBLE PRECISION NOT NULL,
+        exit_time TIMESTAMP NOT NULL,
+        exit_price DOUBLE PRECISION NOT NULL,
+        pnl DOUBLE PRECISION NOT NULL,
+        fees DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+        mae DOUBLE PRECISION NOT NULL,
+        mfe DOUBLE PRECISION NOT NULL,
+        exit_reason VARCHAR NOT NULL
+    );
+
+CREATE INDEX idx_trades_asset_exit_time ON trades (asset, exit_time);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS trades;
+
+DROP TABLE IF EXISTS orders;
+
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE genomes ADD COLUMN front INTEGER;
+ALTER TABLE genomes ADD COLUMN objectives JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE genomes DROP COLUMN objectives;
+ALTER TABLE genomes DROP COLUMN front;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    training_stats (
+        id SERIAL PRIMARY KEY,
+        genome_id INTEGER NOT NULL REFERENCES genomes (id),
+        generation INTEGER NOT NULL,
+        best DOUBLE PRECISION NOT NULL,
+        mean DOUBLE PRECISION NOT NULL,
+        median DOUBLE PRECISION NOT NULL,
+        std DOUBLE PRECISION NOT NULL,
+        diversity DOUBLE PRECISION NOT NULL
+    );
+
+CREATE INDEX idx_training_stats_genome ON training_stats (genome_id, generation);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE training_stats;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE genomes_front_seq OWNED BY genomes.front;
+SELECT setval('genomes_front_seq', COALESCE(MAX(front), 0) + 1, false) FROM genomes;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP SEQUENCE genomes_front_seq;
+-- +goose StatementEnd
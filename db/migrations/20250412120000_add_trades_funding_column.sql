@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE trades ADD COLUMN funding DOUBLE PRECISION NOT NULL DEFAULT 0.0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE trades DROP COLUMN funding;
+-- +goose StatementEnd
@@ -2,9 +2,9 @@ module pivetta.se/crypro-spotter
 
 go 1.23.4
 
-require github.com/cinar/indicator/v2 v2.1.12
-
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/cinar/indicator/v2 v2.1.12
+	github.com/lib/pq v1.10.9
 )
+
+require github.com/davecgh/go-spew v1.1.1 // indirect
@@ -1,52 +1,202 @@
 package main
 
 import (
+	"encoding/csv"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/cinar/indicator/v2/helper"
+	"pivetta.se/crypro-spotter/src/connectors"
 	"pivetta.se/crypro-spotter/src/lib/db"
+	"pivetta.se/crypro-spotter/src/lib/helpers"
 	"pivetta.se/crypro-spotter/src/repositories"
+	"pivetta.se/crypro-spotter/src/sizing"
 	"pivetta.se/crypro-spotter/src/strategies"
 )
 
+// bars the strategy skips while its indicators warm up, loaded before --from
+const stabilization = 60
+
 func main() {
-	days := flag.Int("days", 1, "Days to backtest")
+	days := flag.Int("days", 1, "Days to backtest, up to now, when --from isn't given")
+	from := flag.String("from", "", "Start of the backtest in local time, e.g. 2025-03-01 or \"2025-03-01 12:00\"")
+	to := flag.String("to", "", "End of the backtest in local time, excluded, now when empty")
 	asset := flag.String("asset", "BTCUSDT", "Asset to backtest")
+	genomeID := flag.Int("genome-id", 0, "Genome to backtest, the asset's active one when 0")
+	interval := flag.Duration("interval", time.Minute, "Candle interval the minute snapshots are merged into, e.g. 5m or 1h")
+	equityFile := flag.String("equity-file", "", "CSV file to write the equity curve of every bar to")
+	journal := flag.Bool("journal", false, "Store the backtested orders and trades in the trade journal")
+	sizerName := flag.String("sizer", "fixed", "Position sizer: fixed, percent, risk or kelly")
+	size := flag.Float64("size", 250, "Sizer setting: USDT notional for fixed, % of balance for percent, % of balance risked for risk, Kelly fraction for kelly")
+	equity := flag.Float64("equity", 1000, "Starting account balance in USDT")
+	costs := strategies.CostFlags()
+	withFunding := flag.Bool("funding", true, "Charge open positions the funding rates fetched from Binance, false to backtest offline")
 	flag.Parse()
 
-	backtestRun(*days, *asset)
+	sizer, err := sizing.New(*sizerName, *size)
+	if err != nil {
+		log.Fatalf("Error creating sizer: %v", err)
+	}
+
+	if *interval < time.Minute || *interval%time.Minute != 0 {
+		log.Fatalf("Invalid interval %v, expected a whole number of minutes", *interval)
+	}
+
+	end := time.Now()
+	if *to != "" {
+		end, err = parseDate(*to)
+		if err != nil {
+			log.Fatalf("Invalid --to: %v", err)
+		}
+	}
+	start := end.Add(-time.Duration(*days) * 24 * time.Hour)
+	if *from != "" {
+		start, err = parseDate(*from)
+		if err != nil {
+			log.Fatalf("Invalid --from: %v", err)
+		}
+	}
+	if !start.Before(end) {
+		log.Fatalf("--from %v must be before --to %v", start, end)
+	}
+
+	var funding *connectors.BinanceConnector
+	if *withFunding {
+		funding = &connectors.BinanceConnector{Url: connectors.LIVE}
+	}
+
+	backtestRun(*asset, *genomeID, start, end, *interval, *equityFile, *journal, sizer, *equity, *costs, funding)
 }
 
-func backtestRun(days int, asset string) {
-	historyMinutes := 24 * 60 * days
-	repo, err := repositories.NewDBRepository(asset, historyMinutes+60)
-	if err != nil {
-		log.Fatalf("Error creating repository: %v", err)
+// parseDate parses a date, with or without a time of day, in local time like
+// the stored snapshots
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "2006-01-02 15:04", time.DateTime} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("%q isn't a date like 2025-03-01 or 2025-03-01 12:00", s)
+}
 
-	w, err := db.GetLatestWeights(asset)
+func backtestRun(asset string, genomeID int, from, to time.Time, interval time.Duration, equityFile string, journal bool, sizer sizing.Sizer, equity float64, costs strategies.Costs, funding *connectors.BinanceConnector) {
+	g, err := db.GetLatestGenome(asset)
+	if genomeID != 0 {
+		g, err = db.GetGenome(genomeID)
+	}
 	if err != nil {
 		log.Fatalf("Error getting weights: %v", err)
 	}
 
+	if g == nil {
+		log.Fatalf("No genome stored for %s", asset)
+	}
+	if g.Asset != asset && g.Asset != db.UniversalAsset {
+		log.Printf("Genome %d was trained on %s, backtesting it on %s", g.ID, g.Asset, asset)
+	}
+
+	minutes, err := repositories.GetSnapshotsBetween(db.GetDb(), asset, from.Add(-stabilization*interval), to)
+	if err != nil {
+		log.Fatalf("Error getting %s data: %v", asset, err)
+	}
+	snapshots := strategies.Resample(minutes, interval)
+	if len(snapshots) <= stabilization {
+		log.Fatalf("Not enough %s data between %v and %v, got %d candles", asset, from, to, len(snapshots))
+	}
+
+	costs, err = helpers.WithFunding(funding, costs, asset, snapshots)
+	if err != nil {
+		log.Printf("Error getting funding rates, going on without funding: %v", err)
+	}
+
 	scalp := strategies.Scalping{
-		Weights:       *w,
-		Stabilization: 60,
+		Weights:       g.Weights,
+		Stabilization: stabilization,
 		WithSL:        true,
+		Sizer:         sizer,
+		Equity:        equity,
+		Costs:         costs,
 	}
 
-	r, err := repo.Get(asset)
+	var trades []strategies.Trade
+	var curve []strategies.EquityPoint
+	for step := range scalp.Simulate(helper.SliceToChan(snapshots), false) {
+		if !step.Snapshot.Date.Before(from) {
+			curve = append(curve, strategies.EquityPoint{Date: step.Snapshot.Date, Equity: equity + step.Outcome})
+		}
+		if step.Trade == nil {
+			continue
+		}
+		trades = append(trades, *step.Trade)
+
+		if journal {
+			err := repositories.InsertSimulatedTrade(db.GetDb(), asset, g.ID, *step.Trade)
+			if err != nil {
+				log.Fatalf("Error journaling trade: %v", err)
+			}
+		}
+	}
+
+	r := strategies.NewReport(trades, curve, interval)
+	printReport(asset, g, interval, equity, r)
+
+	if equityFile != "" {
+		err := writeEquity(equityFile, r.Equity)
+		if err != nil {
+			log.Fatalf("Error writing equity curve: %v", err)
+		}
+	}
+}
+
+func printReport(asset string, g *db.Genome, interval time.Duration, equity float64, r strategies.Report) {
+	fmt.Printf("Backtest of genome %d on %s, %v candles, from %s to %s\n\n", g.ID, asset, interval, r.From.Format(time.DateTime), r.To.Format(time.DateTime))
+
+	fmt.Printf("%-6s %-20s %-20s %12s %12s %12s %10s %10s %10s %10s %10s %-12s %12s\n", "Side", "Entry", "Exit", "Entry price", "Exit price", "Quantity", "Fees", "Funding", "PnL", "Return %", "Held", "Reason", "Equity")
+	balance := equity
+	var fees, funding float64
+	for _, t := range r.Ledger {
+		balance += t.PnL
+		fees += t.Fees
+		funding += t.Funding
+		fmt.Printf("%-6s %-20s %-20s %12.4f %12.4f %12.6f %10.2f %10.2f %10.2f %10.2f %10s %-12s %12.2f\n",
+			t.Type, t.EntryTime.Format(time.DateTime), t.ExitTime.Format(time.DateTime), t.EntryPrice, t.ExitPrice, t.Quantity,
+			t.Fees, t.Funding, t.PnL, t.Return()*100, t.ExitTime.Sub(t.EntryTime), t.ExitReason, balance)
+	}
+
+	fmt.Printf("\nEquity:          %.2f -> %.2f USDT\n", equity, balance)
+	fmt.Printf("Total return:    %.2f%%\n", r.Return)
+	fmt.Printf("Fees:            %.2f USDT, funding %.2f USDT\n", fees, funding)
+	fmt.Printf("Max drawdown:    %.2f%% (%.2f USDT)\n", r.MaxDrawdownPct, r.MaxDrawdown)
+	fmt.Printf("Sharpe:          %.2f\n", r.Sharpe)
+	fmt.Printf("Trades:          %d\n", r.Trades)
+	fmt.Printf("Win rate:        %.1f%%\n", r.WinRate*100)
+	fmt.Printf("Profit factor:   %.2f\n", r.ProfitFactor)
+	fmt.Printf("Avg holding:     %v\n", r.AvgHolding)
+	fmt.Printf("Exposure:        %.1f%%\n", r.Exposure*100)
+}
+
+// writeEquity writes the equity curve as CSV
+func writeEquity(path string, curve []strategies.EquityPoint) error {
+	f, err := os.Create(path)
 	if err != nil {
-		log.Fatalf("Error getting BTC data: %v", err)
+		return fmt.Errorf("writeEquity: %w", err)
 	}
+	defer f.Close()
 
-	ac, oc := scalp.ComputeWithOutcome(r, true)
-	var outcome float64
-	for o := range oc {
-		<-ac
-		outcome = o
+	w := csv.NewWriter(f)
+	w.Write([]string{"date", "equity"})
+	for _, p := range curve {
+		w.Write([]string{p.Date.Format(time.RFC3339), strconv.FormatFloat(p.Equity, 'f', 2, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("writeEquity: %w", err)
 	}
 
-	fmt.Printf("Outcome: %f\n", outcome)
+	return f.Close()
 }
@@ -27,6 +27,9 @@ func main() {
 
 	for _, symbol := range s {
 		fmt.Printf("Fetching Symbol: %s\n", symbol)
-		helpers.FetchSnapshots(db, symbol, bc)
+		err := helpers.FetchSnapshots(db, symbol, bc)
+		if err != nil {
+			log.Fatalf("Error fetching %s snapshots: %v\n", symbol, err)
+		}
 	}
 }
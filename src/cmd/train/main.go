@@ -4,16 +4,90 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"path/filepath"
+	"time"
 
+	"github.com/cinar/indicator/v2/helper"
 	"pivetta.se/crypro-spotter/src/connectors"
+	"pivetta.se/crypro-spotter/src/genetics"
 	"pivetta.se/crypro-spotter/src/lib/helpers"
+	"pivetta.se/crypro-spotter/src/optimizers"
+	"pivetta.se/crypro-spotter/src/repositories"
+	"pivetta.se/crypro-spotter/src/strategies"
+	"pivetta.se/crypro-spotter/src/training"
 )
 
 func main() {
 	days := flag.Int("days", 3, "Days to train")
 	count := flag.Int("count", 1, "Number of symbols to train")
+	walkForward := flag.Bool("walk-forward", false, "Evaluate the GA out of sample over sliding train/test windows instead of storing a genome")
+	testDays := flag.Int("test-days", 1, "Walk-forward: days to test each genome on, after its --days of training")
+	history := flag.Int("history", 14, "Walk-forward: days of history to slide the windows over")
+	pick := flag.String("pick", "return", "With --objectives: objective to pick the best solution of the Pareto front on")
+	constraints := flag.String("constraints", "", "With --objectives: comma separated constraints the picked solution must meet, e.g. drawdown<2,trades>=20")
+	cfg := genetics.ConfigFlags()
+	costs := strategies.CostFlags()
+	withFunding := flag.Bool("funding", true, "Charge open positions the funding rates fetched from Binance")
+	checkpointDir := flag.String("checkpoint-dir", "checkpoints", "Directory the GA saves each symbol's run to every generation, empty to disable")
+	resume := flag.Bool("resume", false, "Continue the interrupted run from its checkpoints, skipping the symbols it finished")
+	robust := flag.Bool("robust", false, "Train a single universal genome over every symbol instead of one per symbol")
+	windows := flag.Int("windows", 1, "Robust: windows each symbol's --days are split in, each evaluated on its own")
+	aggregation := flag.String("aggregation", "mean", "Robust: how the fitness over the symbols and windows is combined, mean, worst or a percentile like p25")
+	cacheDir := flag.String("cache-dir", "", "Directory the fitness of evaluated genomes is kept in, to skip them in later runs on the same data")
 	flag.Parse()
 
+	err := cfg.Validate()
+	if err != nil {
+		log.Fatalf("Invalid GA settings: %v\n", err)
+	}
+
+	_, err = optimizers.New(cfg.Optimizer)
+	if err != nil {
+		log.Fatalf("Invalid GA settings: %v\n", err)
+	}
+
+	if *robust {
+		cfg.Windows = *windows
+		cfg.Aggregation = *aggregation
+		if *walkForward || len(cfg.Objectives) > 0 {
+			log.Fatalf("Robust training only supports a single fitness, without walk-forward")
+		}
+		_, err := training.NewAggregation(cfg.Aggregation)
+		if err != nil {
+			log.Fatalf("Invalid aggregation: %v\n", err)
+		}
+		err = training.RobustFitness(cfg.Fitness)
+		if err != nil {
+			log.Fatalf("Invalid fitness: %v\n", err)
+		}
+	}
+
+	// only the GA can be checkpointed
+	checkpoints := *checkpointDir != "" && cfg.Optimizer == "ga" && len(cfg.Objectives) == 0 && !*walkForward && !*robust
+	if *resume && !checkpoints {
+		log.Fatalf("--resume needs --checkpoint-dir and a single fitness ga run\n")
+	}
+
+	var rule training.Rule
+	if len(cfg.Objectives) > 0 {
+		if *walkForward {
+			log.Fatalf("Walk-forward only supports a single fitness, not --objectives")
+		}
+
+		objectives, err := training.NewObjectives(cfg.Objectives, cfg.MinTrades)
+		if err != nil {
+			log.Fatalf("Invalid objectives: %v\n", err)
+		}
+
+		rule, err = training.ParseRule(*pick, *constraints)
+		if err == nil {
+			err = rule.Check(objectives)
+		}
+		if err != nil {
+			log.Fatalf("Invalid pick rule: %v\n", err)
+		}
+	}
+
 	bc := connectors.BinanceConnector{
 		Url: connectors.LIVE,
 	}
@@ -23,9 +97,85 @@ func main() {
 		log.Fatalf("Error fetching symbols: %v\n", err)
 	}
 
+	var funding *connectors.BinanceConnector
+	if *withFunding {
+		funding = &bc
+	}
+
+	if *robust {
+		cfg.Assets = s
+		fmt.Printf("Training universal genome over: %v\n", s)
+		helpers.RobustRun(*days, *cfg, *costs, funding, helpers.RunOptions{CacheDir: *cacheDir})
+		return
+	}
+
 	for _, symbol := range s {
+		if *walkForward {
+			fmt.Printf("Walk-forward Symbol: %s\n", symbol)
+			walkForwardRun(symbol, *history, *days, *testDays, cfg.Seeded(), *costs, funding)
+			continue
+		}
+
 		fmt.Printf("Training Symbol: %s\n", symbol)
-		helpers.GeneticsRun(*days, symbol)
+		if len(cfg.Objectives) > 0 {
+			helpers.ParetoRun(*days, symbol, *cfg, *costs, funding, rule)
+			continue
+		}
+		if !checkpoints {
+			err := helpers.GeneticsRunWith(*days, symbol, *cfg, *costs, funding, helpers.RunOptions{CacheDir: *cacheDir})
+			if err != nil {
+				log.Fatalf("Error training %s: %v\n", symbol, err)
+			}
+			continue
+		}
+
+		cp := genetics.FileCheckpointer{Path: filepath.Join(*checkpointDir, symbol+".json")}
+		if *resume {
+			state, err := cp.Load()
+			if err != nil {
+				log.Fatalf("Error loading checkpoint: %v\n", err)
+			}
+			if state != nil && state.Done {
+				fmt.Printf("Already trained %s, skipping\n", symbol)
+				continue
+			}
+		}
+		err := helpers.GeneticsRunWith(*days, symbol, *cfg, *costs, funding, helpers.RunOptions{Checkpoints: cp, Resume: *resume, CacheDir: *cacheDir})
+		if err != nil {
+			log.Fatalf("Error training %s: %v\n", symbol, err)
+		}
 	}
 
 }
+
+func walkForwardRun(symbol string, history, trainDays, testDays int, cfg genetics.Config, costs strategies.Costs, funding *connectors.BinanceConnector) {
+	repo, err := repositories.NewDBRepository(symbol, history*24*60)
+	if err != nil {
+		log.Fatalf("Error creating repository: %v", err)
+	}
+
+	snapshots, err := repo.Get(symbol)
+	if err != nil {
+		log.Fatalf("Error getting %s data: %v", symbol, err)
+	}
+
+	all := helper.ChanToSlice(snapshots)
+	costs, err = helpers.WithFunding(funding, costs, symbol, all)
+	if err != nil {
+		log.Printf("Error getting funding rates, going on without funding: %v", err)
+	}
+
+	log.Printf("Walk-forward with seed %d", cfg.Seed)
+	folds, total, err := training.WalkForward(all, trainDays, testDays, cfg, costs)
+	if err != nil {
+		log.Fatalf("Error running walk-forward: %v", err)
+	}
+
+	fmt.Printf("%-20s %-20s %10s %10s %8s %8s %10s\n", "Test from", "Test to", "Fitness", "PnL", "Trades", "Win %", "Drawdown")
+	for _, f := range folds {
+		m := f.OutOfSample
+		fmt.Printf("%-20s %-20s %10.2f %10.2f %8d %8.1f %10.2f\n", f.TestFrom.Format(time.DateTime), f.TestTo.Format(time.DateTime), f.InSample.Value, m.PnL, m.Trades, m.WinRate*100, m.MaxDrawdown)
+	}
+	fmt.Printf("Out of sample over %d folds: PnL %.2f, trades %d, win rate %.1f%%, profit factor %.2f, max drawdown %.2f\n",
+		len(folds), total.PnL, total.Trades, total.WinRate*100, total.ProfitFactor, total.MaxDrawdown)
+}
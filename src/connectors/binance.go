@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,18 +15,32 @@ import (
 	"time"
 
 	"github.com/cinar/indicator/v2/asset"
+	"pivetta.se/crypro-spotter/src/market"
 )
 
 const KLINE_LIMIT = "300"
 const KLINE_INTERVAL = "1m"
+const FUNDING_LIMIT = 1000
 const LIVE = "https://fapi.binance.com"
 const TESTNET = "https://testnet.binancefuture.com"
 
+// how many times and how often an order that isn't done filling is checked
+const ORDER_POLLS = 10
+const ORDER_POLL_INTERVAL = 500 * time.Millisecond
+
 type BinanceConnector struct {
 	Connector
-	Url    string
-	Key    string
-	Secret string
+	Url     string
+	Key     string
+	Secret  string
+	Limiter *RateLimiter
+}
+
+// wait blocks on the shared rate limiter, if any, before a request is sent
+func (i *BinanceConnector) wait() {
+	if i.Limiter != nil {
+		i.Limiter.Wait()
+	}
 }
 
 // used to poll many symbols at once, might be useful in the future to use slices of PollData in internal functions
@@ -71,8 +86,79 @@ func (i *BinanceConnector) GetHistory(symbol string, from time.Time) chan *asset
 	return res
 }
 
+// GetFundingRates returns the funding rates of the symbol from from to to,
+// oldest first
+func (i *BinanceConnector) GetFundingRates(symbol string, from, to time.Time) ([]market.FundingRate, error) {
+	var rates []market.FundingRate
+	for {
+		page, err := i.getFundingRates(symbol, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("getFundingRates: %w", err)
+		}
+		rates = append(rates, page...)
+
+		if len(page) < FUNDING_LIMIT {
+			return rates, nil
+		}
+		from = page[len(page)-1].Time.Add(time.Millisecond)
+	}
+}
+
+func (i *BinanceConnector) getFundingRates(symbol string, from, to time.Time) ([]market.FundingRate, error) {
+	baseUrl := i.Url + "/fapi/v1/fundingRate"
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("symbol", symbol)
+	q.Set("startTime", strconv.FormatInt(from.UnixMilli(), 10))
+	q.Set("endTime", strconv.FormatInt(to.UnixMilli(), 10))
+	q.Set("limit", strconv.Itoa(FUNDING_LIMIT))
+	u.RawQuery = q.Encode()
+
+	i.wait()
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	var raw []struct {
+		FundingTime int64  `json:"fundingTime"`
+		FundingRate string `json:"fundingRate"`
+	}
+	err = json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]market.FundingRate, len(raw))
+	for j, r := range raw {
+		rate, err := strconv.ParseFloat(r.FundingRate, 64)
+		if err != nil {
+			return nil, err
+		}
+		rates[j] = market.FundingRate{Time: time.UnixMilli(r.FundingTime), Rate: rate}
+	}
+
+	return rates, nil
+}
+
 func (i *BinanceConnector) GetSymbols(count int) ([]string, error) {
 	result := []string{}
+	i.wait()
 	resp, err := http.Get(i.Url + "/fapi/v1/exchangeInfo")
 	if err != nil {
 		return nil, err
@@ -160,6 +246,7 @@ func (i *BinanceConnector) getKlines(symbol string, from time.Time) ([]asset.Sna
 	}
 	u.RawQuery = q.Encode()
 
+	i.wait()
 	resp, err := http.Get(u.String())
 	if err != nil {
 		return nil, err
@@ -238,6 +325,7 @@ func (i *BinanceConnector) getLastPrice(symbol string) (float64, error) {
 	q.Set("symbol", symbol)
 	u.RawQuery = q.Encode()
 
+	i.wait()
 	resp, err := http.Get(u.String())
 	if err != nil {
 		return 0, err
@@ -250,13 +338,19 @@ func (i *BinanceConnector) getLastPrice(symbol string) (float64, error) {
 		return 0, err
 	}
 
-	var raw map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	var raw struct {
+		Price string `json:"price"`
+	}
 	err = json.Unmarshal(body, &raw)
 	if err != nil {
 		return 0, err
 	}
 
-	p, err := strconv.ParseFloat(raw["price"].(string), 64)
+	p, err := strconv.ParseFloat(raw.Price, 64)
 	if err != nil {
 		return 0, err
 	}
@@ -296,6 +390,7 @@ func (i *BinanceConnector) GetBalance() (float64, error) {
 
 	req.Header.Set("X-MBX-APIKEY", i.Key)
 	client := &http.Client{}
+	i.wait()
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error making request:", err)
@@ -336,11 +431,11 @@ const (
 	SELL Side = "SELL"
 )
 
-func (i *BinanceConnector) PlaceOrder(symbol string, side Side, quantity float64) error {
+func (i *BinanceConnector) PlaceOrder(symbol string, side Side, quantity float64) (*Order, error) {
 	baseUrl := i.Url + "/fapi/v1/order"
 	u, err := url.Parse(baseUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	q := u.Query()
@@ -349,6 +444,7 @@ func (i *BinanceConnector) PlaceOrder(symbol string, side Side, quantity float64
 	q.Set("positionSide", "BOTH")
 	q.Set("type", "MARKET")
 	q.Set("quantity", strconv.FormatFloat(quantity, 'f', 3, 64))
+	q.Set("newOrderRespType", "RESULT")
 	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
 	u.RawQuery = q.Encode()
 	signature := i.generateHMAC(u.RawQuery, i.Secret)
@@ -357,30 +453,208 @@ func (i *BinanceConnector) PlaceOrder(symbol string, side Side, quantity float64
 	req, err := http.NewRequest("POST", u.String(), nil)
 	if err != nil {
 		fmt.Println("Error creating request:", err)
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("X-MBX-APIKEY", i.Key)
 	client := &http.Client{}
+	i.wait()
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error making request:", err)
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Println(string(body))
 
-	var raw interface{}
+	raw, err := decodeOrder(body)
+	if err != nil {
+		return nil, fmt.Errorf("placeOrder: %w", err)
+	}
+
+	// market orders usually come back filled, otherwise wait for them to be
+	for poll := 0; !raw.final() && poll < ORDER_POLLS; poll++ {
+		time.Sleep(ORDER_POLL_INTERVAL)
+		raw, err = i.getOrder(symbol, raw.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("placeOrder: %w", err)
+		}
+	}
+
+	avgPrice, err := strconv.ParseFloat(raw.AvgPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("placeOrder, avgPrice: %w", err)
+	}
+
+	executedQty, err := strconv.ParseFloat(raw.ExecutedQty, 64)
+	if err != nil {
+		return nil, fmt.Errorf("placeOrder, executedQty: %w", err)
+	}
+	if executedQty <= 0 || avgPrice <= 0 {
+		return nil, fmt.Errorf("placeOrder: order %d is %s with nothing filled", raw.OrderID, raw.Status)
+	}
+
+	order := Order{
+		ID:          raw.OrderID,
+		Symbol:      symbol,
+		Side:        side,
+		Quantity:    quantity,
+		Status:      raw.Status,
+		AvgPrice:    avgPrice,
+		ExecutedQty: executedQty,
+	}
+
+	order.Fees, err = i.getOrderFees(symbol, order.ID)
+	if err != nil {
+		// the order went through, missing fees are not worth failing it for
+		log.Printf("Error getting fees for order %d: %v", order.ID, err)
+	}
+
+	return &order, nil
+}
+
+// orderResponse is an order as Binance reports it
+type orderResponse struct {
+	Msg         string `json:"msg"`
+	OrderID     int64  `json:"orderId"`
+	Status      string `json:"status"`
+	AvgPrice    string `json:"avgPrice"`
+	ExecutedQty string `json:"executedQty"`
+}
+
+// final reports whether the order is done filling
+func (o *orderResponse) final() bool {
+	return o.Status != "NEW" && o.Status != "PARTIALLY_FILLED"
+}
+
+func decodeOrder(body []byte) (*orderResponse, error) {
+	var raw orderResponse
+	err := json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if raw.Msg != "" {
+		return nil, errors.New(raw.Msg)
+	}
+	if raw.OrderID == 0 {
+		return nil, fmt.Errorf("no order in response: %s", body)
+	}
+	return &raw, nil
+}
+
+// getOrder queries the current state of an order
+func (i *BinanceConnector) getOrder(symbol string, orderId int64) (*orderResponse, error) {
+	baseUrl := i.Url + "/fapi/v1/order"
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("symbol", symbol)
+	q.Set("orderId", strconv.FormatInt(orderId, 10))
+	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	u.RawQuery = q.Encode()
+	signature := i.generateHMAC(u.RawQuery, i.Secret)
+	u.RawQuery += "&signature=" + signature
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-MBX-APIKEY", i.Key)
+	client := &http.Client{}
+	i.wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeOrder(body)
+	if err != nil {
+		return nil, fmt.Errorf("getOrder: %w", err)
+	}
+	return raw, nil
+}
+
+// getOrderFees sums the commission, in USDT, paid on every fill of an order
+func (i *BinanceConnector) getOrderFees(symbol string, orderId int64) (float64, error) {
+	baseUrl := i.Url + "/fapi/v1/userTrades"
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return 0, err
+	}
+
+	q := u.Query()
+	q.Set("symbol", symbol)
+	q.Set("orderId", strconv.FormatInt(orderId, 10))
+	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	u.RawQuery = q.Encode()
+	signature := i.generateHMAC(u.RawQuery, i.Secret)
+	u.RawQuery += "&signature=" + signature
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("X-MBX-APIKEY", i.Key)
+	client := &http.Client{}
+	i.wait()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	var raw []struct {
+		Commission      string `json:"commission"`
+		CommissionAsset string `json:"commissionAsset"`
+	}
 	err = json.Unmarshal(body, &raw)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	fees := 0.0
+	for _, d := range raw {
+		commission, err := strconv.ParseFloat(d.Commission, 64)
+		if err != nil {
+			return 0, err
+		}
+		// fees paid in another asset, e.g. BNB, are converted at its last price
+		if d.CommissionAsset != "USDT" {
+			price, err := i.getLastPrice(d.CommissionAsset + "USDT")
+			if err != nil {
+				return 0, fmt.Errorf("converting %s commission: %w", d.CommissionAsset, err)
+			}
+			commission *= price
+		}
+		fees += commission
 	}
 
-	return nil
+	return fees, nil
 }
@@ -0,0 +1,53 @@
+package connectors
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// exchange fakes the order endpoints, answering new orders with placed and
+// queries of them with queried
+func exchange(placed, queried string) *BinanceConnector {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/fapi/v1/order" && r.Method == http.MethodPost:
+			fmt.Fprint(w, placed)
+		case r.URL.Path == "/fapi/v1/order":
+			fmt.Fprint(w, queried)
+		case r.URL.Path == "/fapi/v1/userTrades":
+			fmt.Fprint(w, `[{"commission":"0.05","commissionAsset":"USDT"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return &BinanceConnector{Url: server.URL}
+}
+
+func TestPlaceOrderWaitsForFill(t *testing.T) {
+	bc := exchange(
+		`{"orderId":1,"status":"NEW","avgPrice":"0.00","executedQty":"0"}`,
+		`{"orderId":1,"status":"FILLED","avgPrice":"100.50","executedQty":"0.010"}`,
+	)
+	order, err := bc.PlaceOrder("BTCUSDT", BUY, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != "FILLED" || order.AvgPrice != 100.5 || order.ExecutedQty != 0.01 || order.Fees != 0.05 {
+		t.Fatalf("got order %+v, expected it filled", order)
+	}
+}
+
+func TestPlaceOrderNothingFilled(t *testing.T) {
+	for _, placed := range []string{
+		`{"orderId":1,"status":"EXPIRED","avgPrice":"0.00","executedQty":"0"}`,
+		`{"code":-2019,"msg":"Margin is insufficient."}`,
+		`{}`,
+	} {
+		_, err := exchange(placed, "").PlaceOrder("BTCUSDT", BUY, 0.01)
+		if err == nil {
+			t.Errorf("no error placing an order answered with %s", placed)
+		}
+	}
+}
@@ -13,6 +13,18 @@ type PollData struct {
 	LastFetched time.Time
 }
 
+// Order is an order as reported back by the exchange once placed
+type Order struct {
+	ID          int64
+	Symbol      string
+	Side        Side
+	Quantity    float64
+	Status      string
+	AvgPrice    float64
+	ExecutedQty float64
+	Fees        float64
+}
+
 type Connector interface {
 	Poll() ([]PollData, error)
 	GetHistory(symbol string, from time.Time) chan *asset.Snapshot
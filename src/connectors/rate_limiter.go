@@ -0,0 +1,38 @@
+package connectors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests evenly so that every user of a shared connector
+// stays under the exchange request limit together.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRateLimiter(perMinute int) (*RateLimiter, error) {
+	if perMinute < 1 {
+		return nil, fmt.Errorf("newRateLimiter: %d requests per minute, expected at least 1", perMinute)
+	}
+	return &RateLimiter{
+		interval: time.Minute / time.Duration(perMinute),
+	}, nil
+}
+
+// Wait blocks until the caller is allowed to send its next request.
+func (r *RateLimiter) Wait() {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	time.Sleep(wait)
+}
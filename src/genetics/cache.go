@@ -0,0 +1,151 @@
+package genetics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// Cache is a problem memoising the scores of another, so that elites and
+// duplicate individuals are only evaluated once. Scores are keyed by the
+// individual and the dataset, which must identify everything the score
+// depends on beside the individual: the data, the fitness function...
+type Cache struct {
+	problem Problem
+	dataset string
+
+	mu     sync.Mutex
+	scores map[string]Score
+	hits   int
+	misses int
+}
+
+func NewCache(problem Problem, dataset string) *Cache {
+	return &Cache{
+		problem: problem,
+		dataset: dataset,
+		scores:  make(map[string]Score),
+	}
+}
+
+func (c *Cache) Space() params.Space {
+	return c.problem.Space()
+}
+
+func (c *Cache) Evaluate(individual []float64) Score {
+	key := c.key(individual)
+
+	c.mu.Lock()
+	s, ok := c.scores[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+
+	if ok {
+		s.Individual = slices.Clone(individual)
+		return s
+	}
+
+	s = c.problem.Evaluate(individual)
+	c.mu.Lock()
+	c.scores[key] = s
+	c.mu.Unlock()
+
+	return s
+}
+
+// key is a canonical hash of the individual on the dataset
+func (c *Cache) key(individual []float64) string {
+	h := sha256.New()
+	h.Write([]byte(c.dataset))
+	for _, v := range individual {
+		h.Write([]byte{'|'})
+		h.Write(strconv.AppendFloat(nil, v, 'g', -1, 64))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Counts returns the evaluations served from the cache and the ones computed
+func (c *Cache) Counts() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// HitRate is the share of evaluations served from the cache
+func (c *Cache) HitRate() float64 {
+	hits, misses := c.Counts()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// path of the file caching the scores of the dataset in dir
+func (c *Cache) path(dir string) string {
+	sum := sha256.Sum256([]byte(c.dataset))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Load adds the scores saved in dir for the same dataset, if any
+func (c *Cache) Load(dir string) error {
+	data, err := os.ReadFile(c.path(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+
+	var scores map[string]Score
+	err = json.Unmarshal(data, &scores)
+	if err != nil {
+		return fmt.Errorf("load, unmarshal: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, s := range scores {
+		c.scores[k] = s
+	}
+	return nil
+}
+
+// Save writes the scores to dir, for later runs on the same dataset
+func (c *Cache) Save(dir string) error {
+	c.mu.Lock()
+	data, err := json.Marshal(c.scores)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	path := c.path(dir)
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package genetics
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// counting is the bowl problem counting its evaluations
+type counting struct {
+	bowl
+	n *atomic.Int64
+}
+
+func (c counting) Evaluate(individual []float64) Score {
+	c.n.Add(1)
+	return c.bowl.Evaluate(individual)
+}
+
+func TestCacheSkipsReevaluation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Generations = 10
+	cfg.Immigrants = 4
+	cfg.Patience = 0
+	cfg.Seed = 9
+
+	want, err := RunGenetic(bowl{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problem := counting{n: &atomic.Int64{}}
+	cache := NewCache(problem, "bowl")
+	got, err := RunGenetic(cache, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != want.Value || !slices.Equal(got.Individual, want.Individual) {
+		t.Fatalf("cached run found %+v, uncached one %+v", got, want)
+	}
+
+	hits, misses := cache.Counts()
+	if hits == 0 || int64(misses) != problem.n.Load() {
+		t.Fatalf("%d hits and %d misses for %d evaluations", hits, misses, problem.n.Load())
+	}
+	if hits+misses != cfg.PopulationSize*cfg.Generations {
+		t.Fatalf("%d hits and %d misses for %d individuals", hits, misses, cfg.PopulationSize*cfg.Generations)
+	}
+
+	// a later run on the same dataset evaluates nothing
+	dir := t.TempDir()
+	err = cache.Save(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewCache(problem, "bowl")
+	err = reloaded.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := problem.n.Load()
+	_, err = RunGenetic(reloaded, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem.n.Load() != before || reloaded.HitRate() != 1 {
+		t.Fatalf("reloaded cache evaluated %d individuals, hit rate %.2f", problem.n.Load()-before, reloaded.HitRate())
+	}
+
+	// nor is it shared with other datasets
+	other := NewCache(problem, "other")
+	err = other.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Evaluate(got.Individual)
+	if hits, _ := other.Counts(); hits != 0 {
+		t.Fatal("cache hit on another dataset")
+	}
+}
@@ -0,0 +1,142 @@
+package genetics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// individuals kept in the hall of fame
+const HallOfFameSize = 10
+
+// Checkpoint is the state of a GA run at the start of a generation, enough to
+// resume it and get the same result as if it had not been interrupted
+type Checkpoint struct {
+	Config Config `json:"config"`
+	// Dataset identifies the data of the run, which it can only resume on
+	Dataset string `json:"dataset"`
+	// From and To are the period of the data, to load it again when resuming
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Generation int           `json:"generation"`
+	Islands    []IslandState `json:"islands"`
+	// best distinct individuals seen so far, best first
+	HallOfFame []Score `json:"hallOfFame"`
+	// statistics of the generations run so far
+	Stats []GenerationStats `json:"stats"`
+	// the run went through every generation, or stopped early
+	Finished bool `json:"finished"`
+	// the result of the finished run was stored by the caller, see MarkDone
+	Done bool `json:"done"`
+}
+
+// IslandState is the population of an island and the state of its random
+// generator
+type IslandState struct {
+	Population [][]float64 `json:"population"`
+	Rand       []byte      `json:"rand"`
+}
+
+type Checkpointer interface {
+	Save(c Checkpoint) error
+	// Load returns the last checkpoint saved, nil if there is none
+	Load() (*Checkpoint, error)
+}
+
+// FileCheckpointer keeps the last checkpoint as JSON in a file
+type FileCheckpointer struct {
+	Path string
+}
+
+func (f FileCheckpointer) Save(c Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.Path), 0o755)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	// written aside then renamed, so a crash while saving keeps the previous one
+	tmp := f.Path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	err = os.Rename(tmp, f.Path)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	return nil
+}
+
+func (f FileCheckpointer) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+
+	var c Checkpoint
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("load, unmarshal: %w", err)
+	}
+
+	return &c, nil
+}
+
+// MarkDone marks the finished run of the last checkpoint as done, once its
+// result is stored, so that resuming doesn't train it again
+func MarkDone(cp Checkpointer) error {
+	c, err := cp.Load()
+	if err != nil {
+		return fmt.Errorf("markDone: %w", err)
+	}
+	if c == nil || !c.Finished {
+		return fmt.Errorf("markDone: no finished run to mark")
+	}
+
+	c.Done = true
+	err = cp.Save(*c)
+	if err != nil {
+		return fmt.Errorf("markDone: %w", err)
+	}
+	return nil
+}
+
+// induct adds the distinct individuals of a generation, sorted best first, to
+// the hall of fame
+func induct(hallOfFame []Score, sorted []Score) []Score {
+	hallOfFame = slices.Clone(hallOfFame)
+	for _, s := range sorted[:min(HallOfFameSize, len(sorted))] {
+		known := slices.ContainsFunc(hallOfFame, func(h Score) bool {
+			return slices.Equal(h.Individual, s.Individual)
+		})
+		if !known {
+			hallOfFame = append(hallOfFame, s)
+		}
+	}
+
+	slices.SortStableFunc(hallOfFame, func(a, b Score) int {
+		if a.Value < b.Value {
+			return 1
+		}
+		if a.Value > b.Value {
+			return -1
+		}
+		return 0
+	})
+
+	return hallOfFame[:min(HallOfFameSize, len(hallOfFame))]
+}
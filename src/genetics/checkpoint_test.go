@@ -0,0 +1,146 @@
+package genetics
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// bowl scores closeness to the centre of a square
+type bowl struct{}
+
+func (bowl) Space() params.Space {
+	return params.Space{
+		{Name: "x", Kind: params.Continuous, Min: -10, Max: 10, Step: 1},
+		{Name: "y", Kind: params.Integer, Min: -10, Max: 10},
+	}
+}
+
+func (bowl) Evaluate(individual []float64) Score {
+	x, y := individual[0]-3, individual[1]+2
+	return Score{Value: -x*x - y*y, Individual: individual}
+}
+
+// crashing saves to a file, failing once it reaches a generation like a
+// process killed mid run
+type crashing struct {
+	FileCheckpointer
+	at int
+}
+
+func (c crashing) Save(cp Checkpoint) error {
+	if cp.Generation == c.at {
+		return errors.New("crash")
+	}
+	return c.FileCheckpointer.Save(cp)
+}
+
+func TestResumeMatchesUninterruptedRun(t *testing.T) {
+	for _, islands := range []int{1, 3} {
+		cfg := DefaultConfig()
+		cfg.PopulationSize = 20
+		cfg.Generations = 10
+		cfg.Immigrants = 4
+		cfg.Islands = islands
+		cfg.MigrationInterval = 2
+		cfg.Patience = 0
+		cfg.Seed = 9
+
+		want, err := RunGenetic(bowl{}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := FileCheckpointer{Path: filepath.Join(t.TempDir(), "run.json")}
+		_, err = RunGeneticWith(bowl{}, cfg, Options{Checkpoints: crashing{file, 5}})
+		if err == nil {
+			t.Fatal("run didn't crash")
+		}
+
+		// resuming takes the config of the checkpoint, whatever is given
+		got, err := RunGeneticWith(bowl{}, DefaultConfig(), Options{Checkpoints: file, Resume: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Value != want.Value || !slices.Equal(got.Individual, want.Individual) {
+			t.Fatalf("%d islands: resumed run found %+v, uninterrupted one %+v", islands, got, want)
+		}
+
+		cp, err := file.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cp.Finished || cp.Done || cp.Generation != cfg.Generations || len(cp.Islands) != islands {
+			t.Fatalf("%d islands: finished run checkpointed generation %d of %d islands, finished %v, done %v", islands, cp.Generation, len(cp.Islands), cp.Finished, cp.Done)
+		}
+	}
+}
+
+// a run that finished but crashed before its result was stored
+func TestResumeFinishedRun(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Generations = 5
+	cfg.Immigrants = 4
+	cfg.Seed = 9
+
+	file := FileCheckpointer{Path: filepath.Join(t.TempDir(), "run.json")}
+	want, err := RunGeneticWith(bowl{}, cfg, Options{Checkpoints: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evaluated atomic.Int64
+	var stats []GenerationStats
+	got, err := RunGeneticWith(counting{n: &evaluated}, cfg, Options{Checkpoints: file, Resume: true, OnGeneration: func(s GenerationStats) {
+		stats = append(stats, s)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluated.Load() != 0 || got.Value != want.Value || !slices.Equal(got.Individual, want.Individual) {
+		t.Fatalf("resumed finished run evaluated %d individuals and found %+v, expected %+v", evaluated.Load(), got, want)
+	}
+	if len(stats) != cfg.Generations {
+		t.Fatalf("got the stats of %d generations, expected %d", len(stats), cfg.Generations)
+	}
+
+	err = MarkDone(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := file.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Done {
+		t.Fatal("stored run isn't done")
+	}
+}
+
+func TestResumeOtherDataset(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Generations = 10
+	cfg.Immigrants = 4
+	cfg.Seed = 9
+
+	file := FileCheckpointer{Path: filepath.Join(t.TempDir(), "run.json")}
+	_, err := RunGeneticWith(bowl{}, cfg, Options{Checkpoints: crashing{file, 5}, Dataset: "monday"})
+	if err == nil {
+		t.Fatal("run didn't crash")
+	}
+
+	_, err = RunGeneticWith(bowl{}, cfg, Options{Checkpoints: file, Resume: true, Dataset: "tuesday"})
+	if err == nil {
+		t.Fatal("resumed a run on other data")
+	}
+	_, err = RunGeneticWith(bowl{}, cfg, Options{Checkpoints: file, Resume: true, Dataset: "monday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
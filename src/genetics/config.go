@@ -0,0 +1,153 @@
+package genetics
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Config of a GA run, stored along with the genome it produced
+type Config struct {
+	PopulationSize int     `json:"populationSize"`
+	Generations    int     `json:"generations"`
+	MutationRate   float64 `json:"mutationRate"`
+	// best individuals carried over unchanged to the next generation
+	Elitism int `json:"elitism"`
+	// individuals drawn to pick the parents of each child
+	TournamentSize int `json:"tournamentSize"`
+	// random individuals added to each generation for diversity
+	Immigrants int `json:"immigrants"`
+	// seed of every random draw, runs with the same seed and data give the same genome
+	Seed uint64 `json:"seed"`
+	// sub-populations of PopulationSize each evolving on their own, sending their
+	// best Migrants to the next island every MigrationInterval generations
+	Islands           int `json:"islands,omitempty"`
+	MigrationInterval int `json:"migrationInterval,omitempty"`
+	Migrants          int `json:"migrants,omitempty"`
+	// names of the operators breeding each generation, see Crossovers,
+	// Selections and Mutations
+	Crossover string `json:"crossover,omitempty"`
+	Selection string `json:"selection,omitempty"`
+	Mutation  string `json:"mutation,omitempty"`
+	// stop once the best fitness hasn't improved by more than MinImprovement
+	// for Patience generations, 0 to always run every generation
+	Patience       int     `json:"patience,omitempty"`
+	MinImprovement float64 `json:"minImprovement,omitempty"`
+	// name of the fitness function the problem scores individuals with, and the
+	// trades below which an individual is penalised
+	Fitness   string `json:"fitness,omitempty"`
+	MinTrades int    `json:"minTrades,omitempty"`
+	// name of the optimiser searching the space, see optimizers.New
+	Optimizer string `json:"optimizer,omitempty"`
+	// robust training: the assets and the windows per asset each genome is
+	// evaluated on, and how their fitness is aggregated
+	Assets      []string `json:"assets,omitempty"`
+	Windows     int      `json:"windows,omitempty"`
+	Aggregation string   `json:"aggregation,omitempty"`
+	// names of the objectives optimised together by RunNSGA2, none for a single
+	// fitness
+	Objectives []string `json:"objectives,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PopulationSize:    PopulationSize,
+		Generations:       Generations,
+		MutationRate:      MutationRate,
+		Elitism:           5,
+		TournamentSize:    5,
+		Immigrants:        20,
+		Islands:           1,
+		MigrationInterval: 5,
+		Migrants:          2,
+		Patience:          10,
+		Crossover:         "average",
+		Selection:         "tournament",
+		Mutation:          "step",
+		Fitness:           "sharpe",
+		Optimizer:         "ga",
+		MinTrades:         10,
+	}
+}
+
+func (c Config) Validate() error {
+	if c.PopulationSize < 2 {
+		return fmt.Errorf("population size must be at least 2, got %d", c.PopulationSize)
+	}
+	if c.Generations < 1 {
+		return fmt.Errorf("generations must be at least 1, got %d", c.Generations)
+	}
+	if c.MutationRate < 0 || c.MutationRate > 1 {
+		return fmt.Errorf("mutation rate must be between 0 and 1, got %v", c.MutationRate)
+	}
+	if c.Elitism < 0 || c.Immigrants < 0 {
+		return fmt.Errorf("elitism and immigrants can't be negative, got %d and %d", c.Elitism, c.Immigrants)
+	}
+	if c.Elitism+c.Immigrants > c.PopulationSize {
+		return fmt.Errorf("elitism (%d) and immigrants (%d) don't fit in a population of %d", c.Elitism, c.Immigrants, c.PopulationSize)
+	}
+	if c.TournamentSize < 2 || c.TournamentSize > c.PopulationSize {
+		return fmt.Errorf("tournament size must be between 2 and the population size, got %d", c.TournamentSize)
+	}
+	if c.Islands > 1 && c.MigrationInterval < 1 {
+		return fmt.Errorf("migration interval must be at least 1, got %d", c.MigrationInterval)
+	}
+	if c.Islands > 1 && (c.Migrants < 0 || c.Migrants > c.PopulationSize-c.Elitism) {
+		return fmt.Errorf("migrants must be between 0 and the population size less elitism, got %d", c.Migrants)
+	}
+	_, err := c.operators()
+	if err != nil {
+		return err
+	}
+	if c.Patience < 0 || c.MinImprovement < 0 {
+		return fmt.Errorf("patience and min improvement can't be negative, got %d and %v", c.Patience, c.MinImprovement)
+	}
+	if c.MinTrades < 0 {
+		return fmt.Errorf("min trades can't be negative, got %d", c.MinTrades)
+	}
+	return nil
+}
+
+// islands is the number of islands, older configs have none which means one
+func (c Config) islands() int {
+	return max(c.Islands, 1)
+}
+
+// Seeded returns the config with a random seed if none was set, so that the
+// run can be reproduced from its stored config
+func (c Config) Seeded() Config {
+	if c.Seed == 0 {
+		c.Seed = rand.Uint64()
+	}
+	return c
+}
+
+// ConfigFlags registers flags for every setting, defaulting to DefaultConfig.
+// The returned config is filled once the flags are parsed.
+func ConfigFlags() *Config {
+	c := DefaultConfig()
+	flag.IntVar(&c.PopulationSize, "population", c.PopulationSize, "GA population size")
+	flag.IntVar(&c.Generations, "generations", c.Generations, "GA generations")
+	flag.Float64Var(&c.MutationRate, "mutation-rate", c.MutationRate, "GA probability of mutating each gene")
+	flag.IntVar(&c.Elitism, "elitism", c.Elitism, "GA best individuals kept as is in each generation")
+	flag.IntVar(&c.TournamentSize, "tournament", c.TournamentSize, "GA tournament size for selecting parents")
+	flag.IntVar(&c.Immigrants, "immigrants", c.Immigrants, "GA random individuals added to each generation")
+	flag.IntVar(&c.Islands, "islands", c.Islands, "GA islands, sub-populations of --population each")
+	flag.IntVar(&c.MigrationInterval, "migration-interval", c.MigrationInterval, "GA generations between migrations of the best individuals to the next island")
+	flag.IntVar(&c.Migrants, "migrants", c.Migrants, "GA best individuals of each island migrating to the next one")
+	flag.StringVar(&c.Crossover, "crossover", c.Crossover, "GA crossover: average, uniform, single-point, blx or sbx")
+	flag.StringVar(&c.Selection, "selection", c.Selection, "GA parent selection: tournament, roulette or rank")
+	flag.StringVar(&c.Mutation, "mutation", c.Mutation, "GA mutation: step, gaussian or adaptive")
+	flag.IntVar(&c.Patience, "patience", c.Patience, "GA generations without improvement before stopping early, 0 to run every generation")
+	flag.Float64Var(&c.MinImprovement, "min-improvement", c.MinImprovement, "GA fitness gain below which a generation doesn't count as an improvement")
+	flag.Uint64Var(&c.Seed, "seed", c.Seed, "GA random seed, 0 picks one at random")
+	flag.StringVar(&c.Fitness, "fitness", c.Fitness, "Fitness function: sharpe, sortino, calmar, profit-factor, expectancy, return-drawdown or pnl-winrate")
+	flag.IntVar(&c.MinTrades, "min-fitness-trades", c.MinTrades, "Trades below which an individual's fitness is penalised")
+	flag.StringVar(&c.Optimizer, "optimizer", c.Optimizer, "Optimiser: ga, cmaes, pso, random, grid or bayes")
+	flag.Func("objectives", "Comma separated objectives to optimise together with NSGA-II instead of a single fitness, e.g. return,drawdown,trades", func(s string) error {
+		c.Objectives = strings.Split(s, ",")
+		return nil
+	})
+	return &c
+}
@@ -3,263 +3,340 @@ package genetics
 import (
 	"fmt"
 	"log"
+	"math"
 	"math/rand/v2"
+	"runtime"
 	"slices"
 	"sync"
+	"time"
 
-	"github.com/cinar/indicator/v2/asset"
-	"github.com/cinar/indicator/v2/helper"
-	"github.com/cinar/indicator/v2/strategy"
-	"pivetta.se/crypro-spotter/src/strategies"
+	"pivetta.se/crypro-spotter/src/params"
 )
 
+// defaults of the GA settings, see Config
 const (
 	PopulationSize = 100
 	Generations    = 50
 	MutationRate   = 0.2
 )
 
+// Unfit is the score of individuals that can't be judged on their results, e.g.
+// backtests without enough trades, below any score of those that can
+const Unfit = -1e9
+
 type Score struct {
 	Value       float64
 	PnL         float64
 	Successes   int
 	TotalTrades int
-	Individual  strategies.StrategyWeights
+	Individual  []float64
+	// Objectives are maximised together by RunNSGA2, ignored by RunGenetic
+	Objectives []float64
 }
 
-func GenerateRandomWeights() strategies.StrategyWeights {
-	return strategies.StrategyWeights{
-		SuperTrendWeight:  float64(rand.IntN(7)) * 0.5,     // Range [0, 3] in 0.5 increments
-		BollingerWeight:   float64(rand.IntN(7)) * 0.5,     // Range [0, 3]
-		EmaWeight:         float64(rand.IntN(7)) * 0.5,     // Range [0, 3]
-		RsiWeight:         float64(rand.IntN(7)) * 0.5,     // Range [0, 3]
-		MacdWeight:        float64(rand.IntN(7)) * 0.5,     // Range [0, 3]
-		AtrMultiplier:     float64(rand.IntN(6))*0.5 + 1.5, // Range [1.5, 4]
-		StrengthThreshold: float64(rand.IntN(21)) * 0.5,    // Range [0, 10]
-	}
+// Problem is what the GA optimises, a parameter space and how good a point in it is
+type Problem interface {
+	Space() params.Space
+	Evaluate(individual []float64) Score
+}
+
+func GenerateRandomWeights(r *rand.Rand, space params.Space) []float64 {
+	return space.Random(r)
 }
 
 // Crossover combines two parents to create a child
-func Crossover(parent1, parent2 strategies.StrategyWeights) strategies.StrategyWeights {
-	return strategies.StrategyWeights{
-		SuperTrendWeight:  (parent1.SuperTrendWeight + parent2.SuperTrendWeight) / 2,
-		BollingerWeight:   (parent1.BollingerWeight + parent2.BollingerWeight) / 2,
-		EmaWeight:         (parent1.EmaWeight + parent2.EmaWeight) / 2,
-		RsiWeight:         (parent1.RsiWeight + parent2.RsiWeight) / 2,
-		MacdWeight:        (parent1.MacdWeight + parent2.MacdWeight) / 2,
-		StrengthThreshold: (parent1.StrengthThreshold + parent2.StrengthThreshold) / 2,
-		AtrMultiplier:     (parent1.AtrMultiplier + parent2.AtrMultiplier) / 2,
+func Crossover(space params.Space, parent1, parent2 []float64) []float64 {
+	child := make([]float64, len(space))
+	for i := range space {
+		child[i] = (parent1[i] + parent2[i]) / 2
 	}
+
+	return space.Clamp(child)
 }
 
-// Mutate applies random changes to a StrategyWeights
-func Mutate(weights strategies.StrategyWeights) strategies.StrategyWeights {
-	if rand.Float64() < MutationRate {
-		weights.SuperTrendWeight += rand.Float64()*0.5 - 0.25
-	}
-	if rand.Float64() < MutationRate {
-		weights.BollingerWeight += rand.Float64()*0.5 - 0.25
-	}
-	if rand.Float64() < MutationRate {
-		weights.EmaWeight += rand.Float64()*0.5 - 0.25
-	}
-	if rand.Float64() < MutationRate {
-		weights.RsiWeight += rand.Float64()*0.5 - 0.25
-	}
-	if rand.Float64() < MutationRate {
-		weights.MacdWeight += rand.Float64()*0.5 - 0.25
-	}
-	if rand.Float64() < MutationRate {
-		weights.StrengthThreshold += rand.Float64() - 0.5
-	}
-	if rand.Float64() < MutationRate {
-		weights.AtrMultiplier += rand.Float64()*0.4 - 0.2
-	}
+// Mutate applies random changes to an individual, each gene mutating with probability rate
+func Mutate(r *rand.Rand, space params.Space, weights []float64, rate float64) []float64 {
+	weights = slices.Clone(weights)
 
-	if weights.SuperTrendWeight < 0 {
-		weights.SuperTrendWeight = 0
-	}
-	if weights.BollingerWeight < 0 {
-		weights.BollingerWeight = 0
-	}
-	if weights.EmaWeight < 0 {
-		weights.EmaWeight = 0
+	for i, p := range space {
+		if r.Float64() >= rate {
+			continue
+		}
+
+		switch p.Kind {
+		case params.Integer:
+			// move by up to a tenth of the range
+			k := max(1, int(math.Round((p.Max-p.Min)/10)))
+			weights[i] += float64(r.IntN(2*k+1) - k)
+		case params.Discrete:
+			// move to a neighbouring choice
+			j := slices.Index(p.Choices, weights[i]) + r.IntN(3) - 1
+			weights[i] = p.Choices[min(max(j, 0), len(p.Choices)-1)]
+		default:
+			weights[i] += (r.Float64()*2 - 1) * p.Step / 2
+		}
 	}
-	if weights.RsiWeight < 0 {
-		weights.RsiWeight = 0
+
+	return space.Clamp(weights)
+}
+
+func RunGenetic(problem Problem, cfg Config) (*Score, error) {
+	return RunGeneticWith(problem, cfg, Options{})
+}
+
+// Options of a GA run beyond its config, which don't change its result
+type Options struct {
+	// Checkpoints saves the state of the run at the start of every generation
+	Checkpoints Checkpointer
+	// Resume continues from the last checkpoint if there is one, with the
+	// config of the interrupted run
+	Resume bool
+	// Dataset identifies the data of the run, resuming a checkpoint of other
+	// data fails. From and To are its period, saved with the checkpoints.
+	Dataset  string
+	From, To time.Time
+	// OnGeneration is called with the statistics of every generation
+	OnGeneration func(GenerationStats)
+}
+
+func RunGeneticWith(problem Problem, cfg Config, opts Options) (*Score, error) {
+	cp := opts.Checkpoints
+	var state *Checkpoint
+	if cp != nil && opts.Resume {
+		var err error
+		state, err = cp.Load()
+		if err != nil {
+			return nil, fmt.Errorf("runGenetic: %w", err)
+		}
 	}
-	if weights.MacdWeight < 0 {
-		weights.MacdWeight = 0
+	if state != nil && state.Dataset != opts.Dataset {
+		return nil, fmt.Errorf("runGenetic: checkpoint is of dataset %q, not %q", state.Dataset, opts.Dataset)
 	}
-	if weights.StrengthThreshold < 0 {
-		weights.StrengthThreshold = 0
+	// a run that finished before its result was stored returns it again
+	if state != nil && state.Finished {
+		if len(state.HallOfFame) == 0 {
+			return nil, fmt.Errorf("runGenetic: checkpoint of a finished run has no hall of fame")
+		}
+		log.Printf("Resuming a run finished at generation %d", state.Generation)
+		if opts.OnGeneration != nil {
+			for _, s := range state.Stats {
+				opts.OnGeneration(s)
+			}
+		}
+		return &state.HallOfFame[0], nil
 	}
-	if weights.AtrMultiplier < 1.5 {
-		weights.AtrMultiplier = 1.5
+	if state != nil {
+		log.Printf("Resuming from generation %d of %d", state.Generation, state.Config.Generations)
+		cfg = state.Config
 	}
 
-	if weights.SuperTrendWeight > 3 {
-		weights.SuperTrendWeight = 3
-	}
-	if weights.BollingerWeight > 3 {
-		weights.BollingerWeight = 3
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("runGenetic: %w", err)
 	}
-	if weights.EmaWeight > 3 {
-		weights.EmaWeight = 3
+	space := problem.Space()
+	ops, err := cfg.operators()
+	if err != nil {
+		return nil, fmt.Errorf("runGenetic: %w", err)
 	}
-	if weights.RsiWeight > 3 {
-		weights.RsiWeight = 3
-	}
-	if weights.MacdWeight > 3 {
-		weights.MacdWeight = 3
+
+	// every random draw comes from the seed, so a run can be reproduced. Each
+	// island has its own generator so that islands don't depend on each other.
+	islands := make([]island, cfg.islands())
+	for k := range islands {
+		islands[k].pcg = rand.NewPCG(cfg.Seed, cfg.Seed+uint64(k))
+		islands[k].r = rand.New(islands[k].pcg)
 	}
-	if weights.StrengthThreshold > 10 {
-		weights.StrengthThreshold = 10
+
+	var hallOfFame []Score
+	var history []GenerationStats
+	start := 0
+	end := cfg.Generations
+	if state != nil {
+		if len(state.Islands) != len(islands) {
+			return nil, fmt.Errorf("runGenetic: checkpoint has %d islands, config %d", len(state.Islands), len(islands))
+		}
+		for k, is := range state.Islands {
+			err := islands[k].pcg.UnmarshalBinary(is.Rand)
+			if err != nil {
+				return nil, fmt.Errorf("runGenetic, restore rand: %w", err)
+			}
+			islands[k].population = is.Population
+		}
+		hallOfFame = state.HallOfFame
+		history = state.Stats
+		start = state.Generation
+		// stats of the generations before the interruption
+		if opts.OnGeneration != nil {
+			for _, s := range history {
+				opts.OnGeneration(s)
+			}
+		}
+	} else {
+		// Initialize population
+		for k := range islands {
+			islands[k].population = make([][]float64, cfg.PopulationSize)
+			for i := range islands[k].population {
+				islands[k].population[i] = GenerateRandomWeights(islands[k].r, space)
+			}
+		}
 	}
-	if weights.AtrMultiplier > 4 {
-		weights.AtrMultiplier = 4
+
+	save := func(gen int, finished bool) error {
+		if cp == nil {
+			return nil
+		}
+		c := Checkpoint{
+			Config:     cfg,
+			Dataset:    opts.Dataset,
+			From:       opts.From,
+			To:         opts.To,
+			Generation: gen,
+			HallOfFame: hallOfFame,
+			Stats:      history,
+			Finished:   finished,
+		}
+		for _, is := range islands {
+			rs, err := is.pcg.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			c.Islands = append(c.Islands, IslandState{Population: is.population, Rand: rs})
+		}
+		return cp.Save(c)
 	}
 
-	return weights
-}
+	// Genetic Algorithm
+	for gen := start; gen < cfg.Generations; gen++ {
+		err := save(gen, false)
+		if err != nil {
+			return nil, fmt.Errorf("runGenetic, checkpoint: %w", err)
+		}
 
-func FitnessFunction(weights strategies.StrategyWeights, assets <-chan *asset.Snapshot) Score {
-	var outcome float64
-	var trades, successes int
-	scalp := strategies.Scalping{
-		Weights:       weights,
-		Stabilization: 60,
-		WithSL:        true,
-	}
+		// every island is evaluated at once, keeping the workers busy
+		var all [][]float64
+		for _, is := range islands {
+			all = append(all, is.population...)
+		}
+		scores := Evaluate(problem, all)
+
+		sorted := make([][]Score, len(islands))
+		for k := range islands {
+			sorted[k] = scores[k*cfg.PopulationSize : (k+1)*cfg.PopulationSize]
+			slices.SortStableFunc(sorted[k], func(a, b Score) int {
+				if a.Value < b.Value {
+					return 1
+				}
+				if a.Value > b.Value {
+					return -1
+				}
+				return 0
+			})
+			hallOfFame = induct(hallOfFame, sorted[k])
+		}
+		stats := Stats(gen, space, scores)
+		history = append(history, stats)
+		log.Printf("Generation %d: Fitness: %.2f, PnL: %.2f, Accuracy: %.2f, Trades: %d, Mean: %.2f, Median: %.2f, Std: %.2f, Diversity: %.3f\n", gen, hallOfFame[0].Value, hallOfFame[0].PnL, float64(hallOfFame[0].Successes)/float64(hallOfFame[0].TotalTrades), hallOfFame[0].TotalTrades, stats.Mean, stats.Median, stats.Std, stats.Diversity)
+		if opts.OnGeneration != nil {
+			opts.OnGeneration(stats)
+		}
 
-	ac, oc := scalp.ComputeWithOutcome(assets, false)
-	var startValue float64
-	for o := range oc {
-		a := <-ac
+		// Replace old population with new one
+		p := Progress{Generation: gen, Generations: cfg.Generations, Diversity: stats.Diversity}
+		for k := range islands {
+			islands[k].population = generateNewPop(islands[k].r, space, cfg, ops, p, sorted[k])
+		}
 
-		if a == strategy.Buy || a == strategy.Sell {
-			startValue = o
+		if len(islands) > 1 && (gen+1)%cfg.MigrationInterval == 0 {
+			migrate(islands, sorted, cfg.Migrants)
 		}
 
-		if a == strategies.Close {
-			endValue := o - startValue
-			if endValue > 0 {
-				successes++
-			}
-			trades++
+		if cfg.Patience > 0 && stalled(history, cfg.MinImprovement) >= cfg.Patience {
+			log.Printf("No improvement for %d generations, stopping at generation %d", cfg.Patience, gen)
+			end = gen + 1
+			break
 		}
-		outcome = o
 	}
 
-	var value float64
-	if trades == 0 {
-		value = 0
-	} else {
-		value = outcome * (float64(successes) / float64(trades))
+	err = save(end, true)
+	if err != nil {
+		return nil, fmt.Errorf("runGenetic, checkpoint: %w", err)
 	}
-
-	return Score{
-		Value:       value,
-		PnL:         outcome,
-		Individual:  weights,
-		Successes:   successes,
-		TotalTrades: trades,
+	if len(hallOfFame) == 0 {
+		return nil, fmt.Errorf("runGenetic: no individual evaluated")
 	}
-}
 
-func RunGenetic(repo asset.Repository, a string) (*Score, error) {
-	// Initialize population
-	population := make([]strategies.StrategyWeights, PopulationSize)
-	for i := range population {
-		population[i] = GenerateRandomWeights()
-	}
-	var best *Score
+	return &hallOfFame[0], nil
+}
 
-	// Genetic Algorithm
-	for gen := 0; gen < Generations; gen++ {
-		var wg sync.WaitGroup
-		wg.Add(PopulationSize)
-		fitnessScores := make([]Score, PopulationSize)
+// island is a sub-population evolving on its own
+type island struct {
+	pcg        *rand.PCG
+	r          *rand.Rand
+	population [][]float64
+}
 
-		snapshots, err := repo.Get(a)
-		if err != nil {
-			return nil, fmt.Errorf("error getting BTC data: %v", err)
-		}
-		ss := helper.Duplicate(snapshots, PopulationSize)
-
-		// Evaluate fitness
-		for i, individual := range population {
-			go func() {
-				fitnessScores[i] = FitnessFunction(individual, ss[i])
-				wg.Done()
-			}()
+// migrate sends the best individuals of each island to the next one, in a
+// ring, where they replace the last individuals of its new population
+func migrate(islands []island, sorted [][]Score, migrants int) {
+	for k := range islands {
+		next := islands[(k+1)%len(islands)].population
+		for i, s := range sorted[k][:migrants] {
+			next[len(next)-1-i] = s.Individual
 		}
+	}
+}
 
-		wg.Wait()
-
-		slices.SortFunc(fitnessScores, func(a, b Score) int {
-			if a.Value < b.Value {
-				return 1
+// Evaluate scores every individual on a pool of GOMAXPROCS workers
+func Evaluate(problem Problem, population [][]float64) []Score {
+	scores := make([]Score, len(population))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(population)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				scores[i] = problem.Evaluate(population[i])
 			}
-			if a.Value > b.Value {
-				return -1
-			}
-			return 0
-		})
-
-		best = &fitnessScores[0]
-		log.Printf("Generation %d: Fitness: %.2f, PnL: %.2f, Accuracy: %.2f, Trades: %d\n", gen, fitnessScores[0].Value, fitnessScores[0].PnL, float64(fitnessScores[0].Successes)/float64(fitnessScores[0].TotalTrades), fitnessScores[0].TotalTrades)
+		}()
+	}
 
-		// Replace old population with new one
-		population = generateNewPop(fitnessScores)
+	for i := range population {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
 
-	return best, nil
+	return scores
 }
 
-func generateNewPop(fitnessScores []Score) []strategies.StrategyWeights {
-	newPopulation := make([]strategies.StrategyWeights, PopulationSize)
+func generateNewPop(r *rand.Rand, space params.Space, cfg Config, ops operators, p Progress, fitnessScores []Score) [][]float64 {
+	newPopulation := make([][]float64, cfg.PopulationSize)
 
-	// Elitism: Print top 5 individuals and add to next gen
-	for i := 0; i < 5; i++ {
+	// Elitism: Print top individuals and add to next gen
+	for i := 0; i < cfg.Elitism; i++ {
 		//fmt.Printf("Fitness: %.4f, Weights: %+v\n", fitnessScores[i].Value, fitnessScores[i].Individual)
 		newPopulation[i] = fitnessScores[i].Individual
 	}
 
-	// Tournament selection for most
-	for i := 5; i < PopulationSize-20; i++ {
-		// Select 5 random individuals
-		tournament := make([]Score, 5)
-		for j := 0; j < 5; j++ {
-			tournament[j] = fitnessScores[rand.IntN(PopulationSize)]
-		}
-
-		// Sort by fitness
-		slices.SortFunc(tournament, func(a, b Score) int {
-			if a.Value < b.Value {
-				return 1
-			}
-			if a.Value > b.Value {
-				return -1
-			}
-			return 0
-		})
-
-		parent1 := tournament[0].Individual
-		parent2 := tournament[1].Individual
+	// children of selected parents for most
+	for i := cfg.Elitism; i < cfg.PopulationSize-cfg.Immigrants; i++ {
+		parent1, parent2 := ops.selection(r, fitnessScores, cfg)
 
 		// Crossover
-		child := Crossover(parent1, parent2)
+		child := ops.crossover(r, space, parent1.Individual, parent2.Individual)
 
 		// Mutate
-		child = Mutate(child)
+		child = ops.mutation(r, space, child, cfg.MutationRate, p)
 
 		newPopulation[i] = child
 	}
 
-	// last 20 individuals are random new individuals for diversity
-	for i := PopulationSize - 20; i < PopulationSize; i++ {
-		newPopulation[i] = GenerateRandomWeights()
+	// last individuals are random new individuals for diversity
+	for i := cfg.PopulationSize - cfg.Immigrants; i < cfg.PopulationSize; i++ {
+		newPopulation[i] = GenerateRandomWeights(r, space)
 	}
 
 	return newPopulation
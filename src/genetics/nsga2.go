@@ -0,0 +1,201 @@
+package genetics
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// ranked is a score with its NSGA-II rank, the index of its front, and its
+// crowding distance within that front
+type ranked struct {
+	Score
+	rank     int
+	crowding float64
+}
+
+// Dominates reports whether a is at least as good as b on every objective and
+// better on at least one
+func Dominates(a, b []float64) bool {
+	better := false
+	for i := range a {
+		if a[i] < b[i] {
+			return false
+		}
+		if a[i] > b[i] {
+			better = true
+		}
+	}
+	return better
+}
+
+// RunNSGA2 maximises every objective of the problem's scores at once, and
+// returns the Pareto front of the last generation, the individuals no other
+// one dominates
+func RunNSGA2(problem Problem, cfg Config) ([]Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("runNSGA2: %w", err)
+	}
+	space := problem.Space()
+	ops, err := cfg.operators()
+	if err != nil {
+		return nil, fmt.Errorf("runNSGA2: %w", err)
+	}
+	r := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+
+	population := make([][]float64, cfg.PopulationSize)
+	for i := range population {
+		population[i] = GenerateRandomWeights(r, space)
+	}
+	parents := rank(Evaluate(problem, population))
+	if len(parents[0].Objectives) == 0 {
+		return nil, fmt.Errorf("runNSGA2: the problem scores no objectives")
+	}
+
+	for gen := 0; gen < cfg.Generations; gen++ {
+		offspring := rank(Evaluate(problem, breed(r, space, cfg, ops, gen, parents)))
+
+		// parents compete with their children, the best fronts survive
+		all := rank(append(scores(parents), scores(offspring)...))
+		slices.SortStableFunc(all, compareRanked)
+		parents = rank(scores(all[:cfg.PopulationSize]))
+
+		front := paretoFront(parents)
+		log.Printf("Generation %d: Pareto front of %d, objectives of the first: %.2f\n", gen, len(front), front[0].Objectives)
+	}
+
+	return paretoFront(parents), nil
+}
+
+// breed creates a generation of children from parents picked by tournament on
+// rank then crowding, with immigrants for diversity
+func breed(r *rand.Rand, space params.Space, cfg Config, ops operators, gen int, parents []ranked) [][]float64 {
+	p := Progress{Generation: gen, Generations: cfg.Generations, Diversity: Stats(gen, space, scores(parents)).Diversity}
+	pick := func() []float64 {
+		best := parents[r.IntN(len(parents))]
+		for range cfg.TournamentSize - 1 {
+			other := parents[r.IntN(len(parents))]
+			if compareRanked(other, best) < 0 {
+				best = other
+			}
+		}
+		return best.Individual
+	}
+
+	children := make([][]float64, cfg.PopulationSize)
+	for i := range children {
+		if i >= cfg.PopulationSize-cfg.Immigrants {
+			children[i] = GenerateRandomWeights(r, space)
+			continue
+		}
+		children[i] = ops.mutation(r, space, ops.crossover(r, space, pick(), pick()), cfg.MutationRate, p)
+	}
+
+	return children
+}
+
+// compareRanked orders lower ranks first, then less crowded individuals
+func compareRanked(a, b ranked) int {
+	if a.rank != b.rank {
+		return cmp.Compare(a.rank, b.rank)
+	}
+	return cmp.Compare(b.crowding, a.crowding)
+}
+
+func scores(rs []ranked) []Score {
+	s := make([]Score, len(rs))
+	for i, r := range rs {
+		s[i] = r.Score
+	}
+	return s
+}
+
+// rank sorts the scores into fronts of non dominated individuals, each front
+// dominated only by the ones before it, and computes the crowding distances
+func rank(scores []Score) []ranked {
+	rs := make([]ranked, len(scores))
+	dominatedBy := make([]int, len(scores))
+	dominates := make([][]int, len(scores))
+	var front []int
+
+	for i := range scores {
+		rs[i].Score = scores[i]
+		for j := range scores {
+			if Dominates(scores[i].Objectives, scores[j].Objectives) {
+				dominates[i] = append(dominates[i], j)
+			} else if Dominates(scores[j].Objectives, scores[i].Objectives) {
+				dominatedBy[i]++
+			}
+		}
+		if dominatedBy[i] == 0 {
+			front = append(front, i)
+		}
+	}
+
+	for r := 0; len(front) > 0; r++ {
+		crowding(rs, front)
+		var next []int
+		for _, i := range front {
+			rs[i].rank = r
+			for _, j := range dominates[i] {
+				dominatedBy[j]--
+				if dominatedBy[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		front = next
+	}
+
+	return rs
+}
+
+// crowding sets the crowding distance of the individuals of a front, the size
+// of the gap around each along every objective. The extremes are kept.
+func crowding(rs []ranked, front []int) {
+	for _, i := range front {
+		rs[i].crowding = 0
+	}
+
+	for o := range rs[front[0]].Objectives {
+		sorted := slices.Clone(front)
+		slices.SortStableFunc(sorted, func(a, b int) int {
+			return cmp.Compare(rs[a].Objectives[o], rs[b].Objectives[o])
+		})
+
+		lo, hi := rs[sorted[0]].Objectives[o], rs[sorted[len(sorted)-1]].Objectives[o]
+		rs[sorted[0]].crowding = math.Inf(1)
+		rs[sorted[len(sorted)-1]].crowding = math.Inf(1)
+		if hi == lo {
+			continue
+		}
+		for k := 1; k < len(sorted)-1; k++ {
+			gap := rs[sorted[k+1]].Objectives[o] - rs[sorted[k-1]].Objectives[o]
+			rs[sorted[k]].crowding += gap / (hi - lo)
+		}
+	}
+}
+
+// paretoFront returns the distinct individuals of the first front
+func paretoFront(rs []ranked) []Score {
+	var front []Score
+	for _, r := range rs {
+		if r.rank != 0 {
+			continue
+		}
+		duplicate := slices.ContainsFunc(front, func(s Score) bool {
+			return slices.Equal(s.Individual, r.Individual)
+		})
+		if !duplicate {
+			front = append(front, r.Score)
+		}
+	}
+
+	return front
+}
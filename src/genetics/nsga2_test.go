@@ -0,0 +1,49 @@
+package genetics
+
+import (
+	"testing"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// tradeOff has two conflicting objectives, being close to 0 and close to 2,
+// so its Pareto front is every x between 0 and 2
+type tradeOff struct{}
+
+func (tradeOff) Space() params.Space {
+	return params.Space{{Name: "x", Kind: params.Continuous, Min: -10, Max: 10, Step: 1}}
+}
+
+func (tradeOff) Evaluate(individual []float64) Score {
+	x := individual[0]
+	return Score{
+		Individual: individual,
+		Objectives: []float64{-x * x, -(x - 2) * (x - 2)},
+	}
+}
+
+func TestRunNSGA2FindsParetoFront(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PopulationSize = 40
+	cfg.Generations = 30
+	cfg.Seed = 1
+
+	front, err := RunNSGA2(tradeOff{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(front) < 10 {
+		t.Errorf("front of %d solutions, expected it to spread", len(front))
+	}
+	for _, s := range front {
+		if x := s.Individual[0]; x < -0.05 || x > 2.05 {
+			t.Errorf("x = %v is dominated, the front is between 0 and 2", x)
+		}
+		for _, o := range front {
+			if Dominates(o.Objectives, s.Objectives) {
+				t.Errorf("%v on the front is dominated by %v", s.Individual, o.Individual)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package genetics
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// settings of the operators, the usual ones from the literature
+const (
+	// BLX-alpha children fall up to alpha times the parents' distance outside them
+	blxAlpha = 0.5
+	// SBX distribution index, the higher the closer children are to their parents
+	sbxEta = 15
+	// Gaussian mutation deviation, as a fraction of each gene's range
+	gaussianSigma = 0.1
+	// below this diversity adaptive mutation doubles its rate
+	adaptiveDiversity = 0.05
+)
+
+// CrossoverFunc combines two parents into a child
+type CrossoverFunc func(r *rand.Rand, space params.Space, parent1, parent2 []float64) []float64
+
+// SelectionFunc picks two parents from scores sorted best first
+type SelectionFunc func(r *rand.Rand, sorted []Score, cfg Config) (Score, Score)
+
+// MutationFunc applies random changes to an individual, each gene mutating
+// with probability rate
+type MutationFunc func(r *rand.Rand, space params.Space, weights []float64, rate float64, p Progress) []float64
+
+// Progress is how far a run is, for operators adapting to it
+type Progress struct {
+	Generation  int
+	Generations int
+	// diversity of the last generation, see GenerationStats
+	Diversity float64
+}
+
+var Crossovers = map[string]CrossoverFunc{
+	"average": func(_ *rand.Rand, space params.Space, parent1, parent2 []float64) []float64 {
+		return Crossover(space, parent1, parent2)
+	},
+	"uniform":      uniformCrossover,
+	"single-point": singlePointCrossover,
+	"blx":          blxCrossover,
+	"sbx":          sbxCrossover,
+}
+
+var Selections = map[string]SelectionFunc{
+	"tournament": tournamentSelection,
+	"roulette":   rouletteSelection,
+	"rank":       rankSelection,
+}
+
+var Mutations = map[string]MutationFunc{
+	"step": func(r *rand.Rand, space params.Space, weights []float64, rate float64, _ Progress) []float64 {
+		return Mutate(r, space, weights, rate)
+	},
+	"gaussian": gaussianMutation,
+	"adaptive": adaptiveMutation,
+}
+
+// operators of a run, by name in its config
+type operators struct {
+	crossover CrossoverFunc
+	selection SelectionFunc
+	mutation  MutationFunc
+}
+
+// operators returns the operators of the config, the original ones for
+// configs naming none
+func (c Config) operators() (operators, error) {
+	var ops operators
+	var ok bool
+
+	if ops.crossover, ok = Crossovers[orDefault(c.Crossover, "average")]; !ok {
+		return ops, fmt.Errorf("unknown crossover %q, expected average, uniform, single-point, blx or sbx", c.Crossover)
+	}
+	if ops.selection, ok = Selections[orDefault(c.Selection, "tournament")]; !ok {
+		return ops, fmt.Errorf("unknown selection %q, expected tournament, roulette or rank", c.Selection)
+	}
+	if ops.mutation, ok = Mutations[orDefault(c.Mutation, "step")]; !ok {
+		return ops, fmt.Errorf("unknown mutation %q, expected step, gaussian or adaptive", c.Mutation)
+	}
+
+	return ops, nil
+}
+
+// orDefault returns name, or def when it's empty
+func orDefault(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+// uniformCrossover takes each gene from either parent
+func uniformCrossover(r *rand.Rand, space params.Space, parent1, parent2 []float64) []float64 {
+	child := slices.Clone(parent1)
+	for i := range child {
+		if r.IntN(2) == 1 {
+			child[i] = parent2[i]
+		}
+	}
+	return child
+}
+
+// singlePointCrossover takes the genes before a random point from the first
+// parent and the rest from the second
+func singlePointCrossover(r *rand.Rand, space params.Space, parent1, parent2 []float64) []float64 {
+	point := r.IntN(len(parent1) + 1)
+	return append(slices.Clone(parent1[:point]), parent2[point:]...)
+}
+
+// blxCrossover draws each gene in the interval of the parents' genes, widened
+// by alpha of their distance on both sides
+func blxCrossover(r *rand.Rand, space params.Space, parent1, parent2 []float64) []float64 {
+	child := make([]float64, len(parent1))
+	for i := range child {
+		lo, hi := min(parent1[i], parent2[i]), max(parent1[i], parent2[i])
+		d := hi - lo
+		child[i] = lo - blxAlpha*d + r.Float64()*(1+2*blxAlpha)*d
+	}
+	return space.Clamp(child)
+}
+
+// sbxCrossover is simulated binary crossover, spreading children around the
+// parents like single-point crossover does on binary genes
+func sbxCrossover(r *rand.Rand, space params.Space, parent1, parent2 []float64) []float64 {
+	child := slices.Clone(parent1)
+	for i := range child {
+		if r.IntN(2) == 0 {
+			continue
+		}
+
+		u := r.Float64()
+		beta := math.Pow(2*u, 1.0/(sbxEta+1))
+		if u > 0.5 {
+			beta = math.Pow(1/(2*(1-u)), 1.0/(sbxEta+1))
+		}
+		// either of the two children
+		if r.IntN(2) == 0 {
+			beta = -beta
+		}
+		child[i] = 0.5 * ((1+beta)*parent1[i] + (1-beta)*parent2[i])
+	}
+	return space.Clamp(child)
+}
+
+// tournamentSelection picks the two best of TournamentSize random individuals
+func tournamentSelection(r *rand.Rand, sorted []Score, cfg Config) (Score, Score) {
+	tournament := make([]Score, cfg.TournamentSize)
+	for j := range tournament {
+		tournament[j] = sorted[r.IntN(len(sorted))]
+	}
+
+	slices.SortStableFunc(tournament, func(a, b Score) int {
+		if a.Value < b.Value {
+			return 1
+		}
+		if a.Value > b.Value {
+			return -1
+		}
+		return 0
+	})
+
+	return tournament[0], tournament[1]
+}
+
+// rouletteSelection picks individuals with a probability proportional to their
+// fitness, shifted so that the worst has a small chance too
+func rouletteSelection(r *rand.Rand, sorted []Score, cfg Config) (Score, Score) {
+	worst := sorted[len(sorted)-1].Value
+	weights := make([]float64, len(sorted))
+	for i, s := range sorted {
+		weights[i] = s.Value - worst
+	}
+	// the worst gets what a tenth of the mean above it would
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	floor := max(total/float64(len(weights))/10, 1e-9)
+	for i := range weights {
+		weights[i] += floor
+	}
+
+	return sorted[spin(r, weights)], sorted[spin(r, weights)]
+}
+
+// rankSelection picks individuals with a probability proportional to their
+// rank, the best n times more likely than the worst
+func rankSelection(r *rand.Rand, sorted []Score, cfg Config) (Score, Score) {
+	weights := make([]float64, len(sorted))
+	for i := range weights {
+		weights[i] = float64(len(sorted) - i)
+	}
+
+	return sorted[spin(r, weights)], sorted[spin(r, weights)]
+}
+
+// spin returns an index drawn with a probability proportional to its weight
+func spin(r *rand.Rand, weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+
+	x := r.Float64() * total
+	for i, w := range weights {
+		x -= w
+		if x < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// gaussianMutation adds normal noise of gaussianSigma of the range to genes
+func gaussianMutation(r *rand.Rand, space params.Space, weights []float64, rate float64, _ Progress) []float64 {
+	return gaussian(r, space, weights, rate, gaussianSigma)
+}
+
+// adaptiveMutation is Gaussian mutation narrowing as the run goes on, to
+// refine the best individuals, with a rate doubling when the population has
+// converged, to get it out of local optima
+func adaptiveMutation(r *rand.Rand, space params.Space, weights []float64, rate float64, p Progress) []float64 {
+	progress := float64(p.Generation) / float64(max(p.Generations, 1))
+	sigma := gaussianSigma*(1-progress) + gaussianSigma/10
+	if p.Generation > 0 && p.Diversity < adaptiveDiversity {
+		rate = min(2*rate, 1)
+	}
+	return gaussian(r, space, weights, rate, sigma)
+}
+
+func gaussian(r *rand.Rand, space params.Space, weights []float64, rate, sigma float64) []float64 {
+	weights = slices.Clone(weights)
+	for i, p := range space {
+		if r.Float64() >= rate {
+			continue
+		}
+		lo, hi := p.Bounds()
+		weights[i] += r.NormFloat64() * sigma * (hi - lo)
+	}
+	return space.Clamp(weights)
+}
@@ -0,0 +1,57 @@
+package genetics
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestOperatorsConverge(t *testing.T) {
+	for crossover := range Crossovers {
+		for selection := range Selections {
+			for mutation := range Mutations {
+				cfg := DefaultConfig()
+				cfg.PopulationSize = 30
+				cfg.Generations = 30
+				cfg.Immigrants = 4
+				cfg.Crossover = crossover
+				cfg.Selection = selection
+				cfg.Mutation = mutation
+				cfg.Seed = 5
+
+				best, err := RunGenetic(bowl{}, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if best.Value < -1 {
+					t.Errorf("%s, %s, %s: best %v scores %v", crossover, selection, mutation, best.Individual, best.Value)
+				}
+			}
+		}
+	}
+}
+
+func TestCrossoversStayWithinParents(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	space := bowl{}.Space()
+	p1, p2 := []float64{-4, 2}, []float64{6, 8}
+
+	for range 100 {
+		child := uniformCrossover(r, space, p1, p2)
+		for i := range child {
+			if child[i] != p1[i] && child[i] != p2[i] {
+				t.Fatalf("uniform child %v has genes of neither %v nor %v", child, p1, p2)
+			}
+		}
+
+		child = singlePointCrossover(r, space, p1, p2)
+		if len(child) != len(p1) {
+			t.Fatalf("single point child %v of %v and %v", child, p1, p2)
+		}
+
+		// alpha of 0.5 widens [-4, 6] by 5 on each side, clamped to the space
+		child = blxCrossover(r, space, p1, p2)
+		if child[0] < -9 || child[0] > 10 {
+			t.Fatalf("blx child %v out of the widened parents", child)
+		}
+	}
+}
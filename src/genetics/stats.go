@@ -0,0 +1,79 @@
+package genetics
+
+import (
+	"math"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// GenerationStats describe the fitness of a generation and how spread its
+// individuals are, to follow the convergence of a run
+type GenerationStats struct {
+	Generation int     `json:"generation"`
+	Best       float64 `json:"best"`
+	Mean       float64 `json:"mean"`
+	Median     float64 `json:"median"`
+	Std        float64 `json:"std"`
+	// Diversity is the mean standard deviation of each gene, with genes scaled
+	// to [0, 1], 0 once every individual is the same
+	Diversity float64 `json:"diversity"`
+}
+
+func Stats(gen int, space params.Space, scores []Score) GenerationStats {
+	values := make([]float64, len(scores))
+	individuals := make([][]float64, len(scores))
+	for i, s := range scores {
+		values[i] = s.Value
+		individuals[i] = space.Normalize(s.Individual)
+	}
+	slices.Sort(values)
+
+	stats := GenerationStats{
+		Generation: gen,
+		Best:       values[len(values)-1],
+	}
+	stats.Mean, stats.Std = meanStd(values)
+	if n := len(values); n%2 == 1 {
+		stats.Median = values[n/2]
+	} else {
+		stats.Median = (values[n/2-1] + values[n/2]) / 2
+	}
+
+	gene := make([]float64, len(individuals))
+	for g := range space {
+		for i, ind := range individuals {
+			gene[i] = ind[g]
+		}
+		_, std := meanStd(gene)
+		stats.Diversity += std / float64(len(space))
+	}
+
+	return stats
+}
+
+func meanStd(xs []float64) (float64, float64) {
+	var mean, variance float64
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(xs)))
+}
+
+// stalled returns the generations since the best fitness last improved by
+// more than minImprovement
+func stalled(history []GenerationStats, minImprovement float64) int {
+	best := math.Inf(-1)
+	last := 0
+	for i, s := range history {
+		if s.Best > best+minImprovement {
+			best = s.Best
+			last = i
+		}
+	}
+	return len(history) - 1 - last
+}
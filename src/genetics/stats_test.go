@@ -0,0 +1,39 @@
+package genetics
+
+import (
+	"testing"
+)
+
+func TestRunGeneticStopsEarly(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Generations = 200
+	cfg.Immigrants = 4
+	cfg.Patience = 5
+	cfg.Seed = 3
+
+	var stats []GenerationStats
+	_, err := RunGeneticWith(bowl{}, cfg, Options{
+		OnGeneration: func(s GenerationStats) { stats = append(stats, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) == cfg.Generations {
+		t.Fatalf("ran all %d generations on a bowl", cfg.Generations)
+	}
+	if stalled(stats, 0) != cfg.Patience {
+		t.Errorf("stopped after %d generations without improvement, patience is %d", stalled(stats, 0), cfg.Patience)
+	}
+
+	first, last := stats[0], stats[len(stats)-1]
+	if last.Diversity >= first.Diversity {
+		t.Errorf("diversity went from %v to %v, expected the population to converge", first.Diversity, last.Diversity)
+	}
+	for _, s := range stats {
+		if s.Best < s.Median || s.Std < 0 {
+			t.Errorf("inconsistent stats %+v", s)
+		}
+	}
+}
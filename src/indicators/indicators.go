@@ -0,0 +1,384 @@
+// Package indicators holds streaming versions of the technical indicators used
+// by the strategies. Each one is advanced synchronously with Next, one value at
+// a time, so that every indicator stays aligned on the same snapshot and the
+// results are reproducible.
+package indicators
+
+import (
+	"math"
+)
+
+// window keeps the last n values pushed into it
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(n int) *window {
+	return &window{values: make([]float64, n)}
+}
+
+// push adds a value, returning the one it evicted
+func (w *window) push(v float64) float64 {
+	old := w.values[w.next]
+	w.values[w.next] = v
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.full = true
+	}
+	return old
+}
+
+// at returns the i-th value, oldest first
+func (w *window) at(i int) float64 {
+	if !w.full {
+		return w.values[i]
+	}
+	return w.values[(w.next+i)%len(w.values)]
+}
+
+func (w *window) len() int {
+	if w.full {
+		return len(w.values)
+	}
+	return w.next
+}
+
+// Sma is the simple moving average
+type Sma struct {
+	Period int
+	window *window
+	sum    float64
+}
+
+func NewSma(period int) *Sma {
+	return &Sma{Period: period, window: newWindow(period)}
+}
+
+func (s *Sma) Next(v float64) float64 {
+	if s.window.full {
+		s.sum -= s.window.push(v)
+	} else {
+		s.window.push(v)
+	}
+	s.sum += v
+
+	return s.sum / float64(s.window.len())
+}
+
+func (s *Sma) Ready() bool {
+	return s.window.full
+}
+
+// Ema is the exponential moving average, seeded with the SMA of its first period
+type Ema struct {
+	Period int
+	sma    *Sma
+	value  float64
+	count  int
+}
+
+func NewEma(period int) *Ema {
+	return &Ema{Period: period, sma: NewSma(period)}
+}
+
+func (e *Ema) Next(v float64) float64 {
+	e.count++
+	if e.count <= e.Period {
+		e.value = e.sma.Next(v)
+		return e.value
+	}
+
+	e.value += (v - e.value) * 2 / float64(e.Period+1)
+	return e.value
+}
+
+func (e *Ema) Ready() bool {
+	return e.count >= e.Period
+}
+
+// Rma is Wilder's running moving average, seeded with the SMA of its first period
+type Rma struct {
+	Period int
+	sma    *Sma
+	value  float64
+	count  int
+}
+
+func NewRma(period int) *Rma {
+	return &Rma{Period: period, sma: NewSma(period)}
+}
+
+func (r *Rma) Next(v float64) float64 {
+	r.count++
+	if r.count <= r.Period {
+		r.value = r.sma.Next(v)
+		return r.value
+	}
+
+	r.value = (r.value*float64(r.Period-1) + v) / float64(r.Period)
+	return r.value
+}
+
+func (r *Rma) Ready() bool {
+	return r.count >= r.Period
+}
+
+// Wma is the linearly weighted moving average, the newest value weighing the most
+type Wma struct {
+	Period int
+	window *window
+}
+
+func NewWma(period int) *Wma {
+	return &Wma{Period: period, window: newWindow(period)}
+}
+
+func (w *Wma) Next(v float64) float64 {
+	w.window.push(v)
+
+	n := w.window.len()
+	sum, weights := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		weight := float64(i + 1)
+		sum += w.window.at(i) * weight
+		weights += weight
+	}
+
+	return sum / weights
+}
+
+func (w *Wma) Ready() bool {
+	return w.window.full
+}
+
+// Hma is the Hull moving average
+type Hma struct {
+	half   *Wma
+	full   *Wma
+	smooth *Wma
+}
+
+func NewHma(period int) *Hma {
+	return &Hma{
+		half:   NewWma(max(period/2, 1)),
+		full:   NewWma(period),
+		smooth: NewWma(max(int(math.Sqrt(float64(period))), 1)),
+	}
+}
+
+func (h *Hma) Next(v float64) float64 {
+	half := h.half.Next(v)
+	full := h.full.Next(v)
+	if !h.full.Ready() {
+		return full
+	}
+
+	return h.smooth.Next(2*half - full)
+}
+
+func (h *Hma) Ready() bool {
+	return h.smooth.Ready()
+}
+
+// Rsi is the relative strength index, from 0 to 100
+type Rsi struct {
+	gains  *Rma
+	losses *Rma
+	prev   float64
+	count  int
+}
+
+func NewRsi(period int) *Rsi {
+	return &Rsi{gains: NewRma(period), losses: NewRma(period)}
+}
+
+func (r *Rsi) Next(close float64) float64 {
+	r.count++
+	change := close - r.prev
+	r.prev = close
+	if r.count == 1 {
+		return 50
+	}
+
+	gain := r.gains.Next(math.Max(change, 0))
+	loss := r.losses.Next(math.Max(-change, 0))
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+
+	return 100 - 100/(1+gain/loss)
+}
+
+func (r *Rsi) Ready() bool {
+	return r.gains.Ready()
+}
+
+// Macd is the moving average convergence divergence, with its signal line
+type Macd struct {
+	fast   *Ema
+	slow   *Ema
+	signal *Ema
+}
+
+func NewMacd(fast, slow, signal int) *Macd {
+	return &Macd{fast: NewEma(fast), slow: NewEma(slow), signal: NewEma(signal)}
+}
+
+func (m *Macd) Next(close float64) (float64, float64) {
+	fast := m.fast.Next(close)
+	slow := m.slow.Next(close)
+	if !m.slow.Ready() {
+		return 0, 0
+	}
+
+	macd := fast - slow
+	return macd, m.signal.Next(macd)
+}
+
+func (m *Macd) Ready() bool {
+	return m.signal.Ready()
+}
+
+// BollingerBands is an SMA with bands at a number of standard deviations around it
+type BollingerBands struct {
+	Deviations float64
+	sma        *Sma
+}
+
+func NewBollingerBands(period int, deviations float64) *BollingerBands {
+	return &BollingerBands{Deviations: deviations, sma: NewSma(period)}
+}
+
+// Next returns the upper, middle and lower bands
+func (b *BollingerBands) Next(close float64) (float64, float64, float64) {
+	middle := b.sma.Next(close)
+
+	n := b.sma.window.len()
+	sum2 := 0.0
+	for i := 0; i < n; i++ {
+		d := b.sma.window.at(i) - middle
+		sum2 += d * d
+	}
+	std := math.Sqrt(sum2 / float64(n))
+
+	return middle + b.Deviations*std, middle, middle - b.Deviations*std
+}
+
+func (b *BollingerBands) Ready() bool {
+	return b.sma.Ready()
+}
+
+// movingAverage is what Atr smooths the true range with
+type movingAverage interface {
+	Next(v float64) float64
+	Ready() bool
+}
+
+// Atr is the average true range
+type Atr struct {
+	ma        movingAverage
+	prevClose float64
+	count     int
+}
+
+// NewAtr smooths the true range with an SMA
+func NewAtr(period int) *Atr {
+	return &Atr{ma: NewSma(period)}
+}
+
+// Next returns 0 on the first snapshot, whose true range needs the close
+// before it
+func (a *Atr) Next(high, low, close float64) float64 {
+	a.count++
+	prevClose := a.prevClose
+	a.prevClose = close
+	if a.count == 1 {
+		return 0
+	}
+
+	tr := math.Max(high-low, math.Max(math.Abs(high-prevClose), math.Abs(prevClose-low)))
+	return a.ma.Next(tr)
+}
+
+func (a *Atr) Ready() bool {
+	return a.ma.Ready()
+}
+
+// SuperTrend follows the price with a band a multiple of the ATR away from
+// the median, flipping sides when the close crosses it.
+type SuperTrend struct {
+	Multiplier float64
+	atr        *Atr
+
+	started    bool
+	upTrend    bool
+	prevClose  float64
+	upperBand  float64
+	lowerBand  float64
+	superTrend float64
+}
+
+// NewSuperTrend smooths its ATR with an HMA, reacting faster than an SMA would
+func NewSuperTrend(period int, multiplier float64) *SuperTrend {
+	return &SuperTrend{
+		Multiplier: multiplier,
+		atr:        &Atr{ma: NewHma(period)},
+	}
+}
+
+func (s *SuperTrend) Next(high, low, close float64) float64 {
+	atr := s.atr.Next(high, low, close)
+	if !s.atr.Ready() {
+		s.prevClose = close
+		return close
+	}
+
+	median := (high + low) / 2
+	basicUpper := median + s.Multiplier*atr
+	basicLower := median - s.Multiplier*atr
+
+	if !s.started {
+		s.started = true
+		s.upperBand = basicUpper
+		s.lowerBand = basicLower
+		s.superTrend = basicLower
+		s.prevClose = close
+		return s.superTrend
+	}
+
+	if basicUpper < s.upperBand || s.prevClose > s.upperBand {
+		s.upperBand = basicUpper
+	}
+	if basicLower > s.lowerBand || s.prevClose < s.lowerBand {
+		s.lowerBand = basicLower
+	}
+
+	if s.upTrend {
+		if close <= s.upperBand {
+			s.superTrend = s.upperBand
+		} else {
+			s.superTrend = s.lowerBand
+			s.upTrend = false
+		}
+	} else {
+		if close >= s.lowerBand {
+			s.superTrend = s.lowerBand
+		} else {
+			s.superTrend = s.upperBand
+			s.upTrend = true
+		}
+	}
+
+	s.prevClose = close
+	return s.superTrend
+}
+
+func (s *SuperTrend) Ready() bool {
+	return s.started
+}
@@ -0,0 +1,170 @@
+package indicators
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/cinar/indicator/v2/helper"
+	"github.com/cinar/indicator/v2/momentum"
+	"github.com/cinar/indicator/v2/trend"
+	"github.com/cinar/indicator/v2/volatility"
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+)
+
+// walk returns the highs, lows and closes of a random walk
+func walk(n int) ([]float64, []float64, []float64) {
+	highs, lows, closes := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, s := range testutil.RandomWalk(n) {
+		highs[i], lows[i], closes[i] = s.High, s.Low, s.Close
+	}
+	return highs, lows, closes
+}
+
+// drain reads the outputs of a cinar indicator together, as they're fed
+// from the same input
+func drain(outputs ...<-chan float64) [][]float64 {
+	values := make([][]float64, len(outputs))
+	var wg sync.WaitGroup
+	for i, c := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i] = helper.ChanToSlice(c)
+		}()
+	}
+	wg.Wait()
+	return values
+}
+
+// compare checks the streamed values against those cinar computed over the
+// same input, which start once its indicator is idle no more
+func compare(t *testing.T, name string, got []float64, golden []float64) {
+	t.Helper()
+	idle := len(got) - len(golden)
+	if len(golden) == 0 || idle < 0 {
+		t.Fatalf("%s: cinar computed %d values out of %d", name, len(golden), len(got))
+	}
+	for i, w := range golden {
+		if g := got[idle+i]; math.Abs(g-w) > 1e-9*max(1, math.Abs(w)) {
+			t.Fatalf("%s: %v at %d, cinar %v", name, g, idle+i, w)
+		}
+	}
+}
+
+func TestRsi(t *testing.T) {
+	_, _, closes := walk(1000)
+	for _, period := range []int{7, 14, 28} {
+		rsi := NewRsi(period)
+		got := make([]float64, len(closes))
+		for i, c := range closes {
+			got[i] = rsi.Next(c)
+		}
+		compare(t, "rsi", got, drain(momentum.NewRsiWithPeriod[float64](period).Compute(helper.SliceToChan(closes)))[0])
+	}
+}
+
+func TestMacd(t *testing.T) {
+	_, _, closes := walk(1000)
+	for _, p := range [][3]int{{12, 26, 9}, {6, 40, 5}, {18, 20, 14}} {
+		macd := NewMacd(p[0], p[1], p[2])
+		macds, signals := make([]float64, len(closes)), make([]float64, len(closes))
+		for i, c := range closes {
+			macds[i], signals[i] = macd.Next(c)
+		}
+		want := drain(trend.NewMacdWithPeriod[float64](p[0], p[1], p[2]).Compute(helper.SliceToChan(closes)))
+		compare(t, "macd", macds, want[0])
+		compare(t, "macd signal", signals, want[1])
+	}
+}
+
+func TestBollingerBands(t *testing.T) {
+	_, _, closes := walk(1000)
+	for _, period := range []int{10, 20, 40} {
+		// cinar's bands are always 2 deviations away
+		bollinger := NewBollingerBands(period, 2)
+		uppers, middles, lowers := make([]float64, len(closes)), make([]float64, len(closes)), make([]float64, len(closes))
+		for i, c := range closes {
+			uppers[i], middles[i], lowers[i] = bollinger.Next(c)
+		}
+		bb := volatility.NewBollingerBands[float64]()
+		bb.Period = period
+		want := drain(bb.Compute(helper.SliceToChan(closes)))
+		compare(t, "bollinger upper", uppers, want[0])
+		compare(t, "bollinger middle", middles, want[1])
+		compare(t, "bollinger lower", lowers, want[2])
+	}
+}
+
+// cinar's WMA doesn't normalise its weights, scaling the average by a
+// quarter of its period plus one, which is taken out here
+func TestWma(t *testing.T) {
+	_, _, closes := walk(1000)
+	for _, period := range []int{3, 7, 14} {
+		wma := NewWma(period)
+		got := make([]float64, len(closes))
+		for i, c := range closes {
+			got[i] = wma.Next(c)
+		}
+		want := drain(trend.NewWmaWith[float64](period).Compute(helper.SliceToChan(closes)))[0]
+		for i := range want {
+			want[i] /= float64(period+1) / 4
+		}
+		compare(t, "wma", got, want)
+	}
+}
+
+// the HMA can't be compared with cinar's, built on its WMA, it's checked
+// against its definition instead: the WMA over the square root of the period
+// of twice the WMA over half the period minus the WMA over the period
+func TestHma(t *testing.T) {
+	_, _, closes := walk(1000)
+	for _, period := range []int{7, 14, 28} {
+		hma := NewHma(period)
+		half, full, smooth := NewWma(period/2), NewWma(period), NewWma(int(math.Sqrt(float64(period))))
+		for i, c := range closes {
+			got := hma.Next(c)
+			want := smooth.Next(2*half.Next(c) - full.Next(c))
+			// the smoothing starts once the WMA over the period is full
+			if i < period-1 {
+				smooth = NewWma(int(math.Sqrt(float64(period))))
+				continue
+			}
+			if math.Abs(got-want) > 1e-9*math.Abs(want) {
+				t.Fatalf("hma(%d): %v at %d, expected %v", period, got, i, want)
+			}
+		}
+		if !hma.Ready() {
+			t.Fatalf("hma(%d) not ready", period)
+		}
+	}
+}
+
+func TestAtr(t *testing.T) {
+	highs, lows, closes := walk(1000)
+	atr := NewAtr(14)
+	got := make([]float64, len(closes))
+	for i := range closes {
+		got[i] = atr.Next(highs[i], lows[i], closes[i])
+	}
+	want := volatility.NewAtrWithPeriod[float64](14).Compute(helper.SliceToChan(highs), helper.SliceToChan(lows), helper.SliceToChan(closes))
+	compare(t, "atr", got, drain(want)[0])
+}
+
+// the bands are compared with cinar smoothing the ATR with an SMA, as its HMA
+// is off, see TestHma
+func TestSuperTrend(t *testing.T) {
+	highs, lows, closes := walk(1000)
+	for _, p := range []struct {
+		period     int
+		multiplier float64
+	}{{7, 1.5}, {14, 2.5}, {28, 4}} {
+		superTrend := &SuperTrend{Multiplier: p.multiplier, atr: NewAtr(p.period)}
+		got := make([]float64, len(closes))
+		for i := range closes {
+			got[i] = superTrend.Next(highs[i], lows[i], closes[i])
+		}
+		want := volatility.NewSuperTrendWithMa(trend.NewSmaWithPeriod[float64](p.period), p.multiplier).Compute(helper.SliceToChan(highs), helper.SliceToChan(lows), helper.SliceToChan(closes))
+		compare(t, "supertrend", got, drain(want)[0])
+	}
+}
@@ -16,9 +16,21 @@ import (
 	"pivetta.se/crypro-spotter/src/strategies"
 )
 
+// UniversalAsset is the asset genomes trained over several assets are stored
+// under, for assets with no genome of their own
+const UniversalAsset = "UNIVERSAL"
+
 var db *sql.DB
 var once sync.Once
 
+type Genome struct {
+	ID      int
+	Asset   string
+	Date    time.Time
+	Weights strategies.StrategyWeights
+	Fitness float64
+}
+
 func GetDb() *sql.DB {
 	once.Do(func() {
 		host := os.Getenv("POSTGRES_HOST")
@@ -68,7 +80,7 @@ func GetLatestWeights(a string) (*strategies.StrategyWeights, error) {
 
 	var rawJson string
 	var weights *strategies.StrategyWeights
-	query := `SELECT genome FROM genomes WHERE asset = $1 ORDER BY date DESC LIMIT 1`
+	query := `SELECT genome FROM genomes WHERE asset = $1 AND promoted ORDER BY date DESC LIMIT 1`
 	row := db.QueryRow(query, a)
 	err := row.Scan(&rawJson)
 	if err != nil {
@@ -88,19 +100,147 @@ func GetLatestWeights(a string) (*strategies.StrategyWeights, error) {
 	return weights, nil
 }
 
-func StoreWeights(a string, best *genetics.Score) error {
+func GetLatestGenome(a string) (*Genome, error) {
 	db := GetDb()
 
-	jsonData, err := json.Marshal(best.Individual)
+	var rawJson string
+	genome := Genome{Asset: a}
+	query := `SELECT id, date, genome, fitness FROM genomes WHERE asset = $1 AND promoted ORDER BY date DESC LIMIT 1`
+	row := db.QueryRow(query, a)
+	err := row.Scan(&genome.ID, &genome.Date, &rawJson, &genome.Fitness)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getLatestGenome: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(rawJson), &genome.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("getLatestGenome, unmarshal: %w", err)
+	}
+
+	return &genome, nil
+}
+
+// GetGenome returns the genome with the given ID, promoted or not
+func GetGenome(id int) (*Genome, error) {
+	db := GetDb()
+
+	var rawJson string
+	genome := Genome{ID: id}
+	query := `SELECT asset, date, genome, fitness FROM genomes WHERE id = $1`
+	row := db.QueryRow(query, id)
+	err := row.Scan(&genome.Asset, &genome.Date, &rawJson, &genome.Fitness)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getGenome: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(rawJson), &genome.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("getGenome, unmarshal: %w", err)
+	}
+
+	return &genome, nil
+}
+
+// StoreWeights stores a genome along with the settings of the GA that trained it.
+// Only promoted genomes are returned by GetLatestGenome, rejected candidates are
+// kept for reference. It returns the ID of the genome.
+func StoreWeights(a string, weights strategies.StrategyWeights, fitness float64, cfg genetics.Config, promoted bool) (int, error) {
+	db := GetDb()
+
+	jsonData, err := json.Marshal(weights)
+	if err != nil {
+		return 0, err
 	}
 	genome := string(jsonData) // Store JSON as string in DB
 
-	query := `INSERT INTO genomes (asset, date, genome, fitness) VALUES ($1, $2, $3, $4)`
-	_, err = db.Exec(query, a, time.Now(), genome, best.Value)
+	cfgData, err := json.Marshal(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	query := `INSERT INTO genomes (asset, date, genome, fitness, training, promoted) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err = db.QueryRow(query, a, time.Now(), genome, fitness, string(cfgData), promoted).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("storeWeights: %w", err)
+	}
+
+	return id, nil
+}
+
+// StoreTrainingStats stores the statistics of every generation of the run
+// that trained a genome
+func StoreTrainingStats(genomeID int, stats []genetics.GenerationStats) error {
+	db := GetDb()
+
+	query := `INSERT INTO training_stats (genome_id, generation, best, mean, median, std, diversity) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	for _, s := range stats {
+		_, err := db.Exec(query, genomeID, s.Generation, s.Best, s.Mean, s.Median, s.Std, s.Diversity)
+		if err != nil {
+			return fmt.Errorf("storeTrainingStats: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ParetoMember is a solution of a multi-objective training
+type ParetoMember struct {
+	Weights    strategies.StrategyWeights
+	Fitness    float64
+	Objectives map[string]float64
+}
+
+// StoreParetoFront stores every solution of a Pareto front as a genome, sharing
+// a front number. Only the chosen one is promoted, -1 promotes none.
+func StoreParetoFront(a string, members []ParetoMember, chosen int, cfg genetics.Config) error {
+	db := GetDb()
+
+	cfgData, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("storeParetoFront: %w", err)
+	}
+	defer tx.Rollback()
+
+	// a sequence, so that fronts stored at once don't get the same number
+	var front int
+	err = tx.QueryRow(`SELECT nextval('genomes_front_seq')`).Scan(&front)
+	if err != nil {
+		return fmt.Errorf("storeParetoFront: %w", err)
+	}
+
+	query := `INSERT INTO genomes (asset, date, genome, fitness, training, promoted, front, objectives) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	date := time.Now()
+	for i, m := range members {
+		weights, err := json.Marshal(m.Weights)
+		if err != nil {
+			return err
+		}
+		objectives, err := json.Marshal(m.Objectives)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(query, a, date, string(weights), m.Fitness, string(cfgData), i == chosen, front, string(objectives))
+		if err != nil {
+			return fmt.Errorf("storeParetoFront: %w", err)
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("storeWeights: %w", err)
+		return fmt.Errorf("storeParetoFront: %w", err)
 	}
 
 	return nil
@@ -6,20 +6,27 @@ import (
 	"log"
 	"time"
 
+	"github.com/cinar/indicator/v2/asset"
+	"github.com/cinar/indicator/v2/helper"
 	"pivetta.se/crypro-spotter/src/connectors"
 	"pivetta.se/crypro-spotter/src/genetics"
 	"pivetta.se/crypro-spotter/src/lib/db"
+	"pivetta.se/crypro-spotter/src/optimizers"
 	"pivetta.se/crypro-spotter/src/repositories"
+	"pivetta.se/crypro-spotter/src/strategies"
+	"pivetta.se/crypro-spotter/src/training"
 )
 
 func CalculateQuantity(usd float64, price float64) float64 {
 	return usd / price
 }
 
-func FetchSnapshots(db *sql.DB, symbol string, bc connectors.BinanceConnector) {
+// FetchSnapshots stores the klines of the symbol since its most recent
+// snapshot, or of the last 15 days when there's none
+func FetchSnapshots(db *sql.DB, symbol string, bc connectors.BinanceConnector) error {
 	recentSnapshot, err := repositories.GetLatestSnapshot(db, symbol)
 	if err != nil {
-		log.Fatalf("Error fetching most recent snapshot: %v\n", err)
+		return fmt.Errorf("fetchSnapshots: %w", err)
 	}
 	fmt.Printf("Most recent snapshot for %s: %+v\n", symbol, recentSnapshot)
 
@@ -34,23 +41,363 @@ func FetchSnapshots(db *sql.DB, symbol string, bc connectors.BinanceConnector) {
 	}
 
 	ss := bc.GetHistory(symbol, date)
-	repositories.InsertSnapshots(db, symbol, ss)
+	err = repositories.InsertSnapshots(db, symbol, ss)
+	if err != nil {
+		// let the history goroutine finish rather than block on it forever
+		for range ss {
+		}
+		return fmt.Errorf("fetchSnapshots: %w", err)
+	}
+	return nil
+}
+
+// RunOptions are the settings of a training run that don't change its result
+type RunOptions struct {
+	// Checkpoints saves the GA every generation, resuming from the last
+	// checkpoint with Resume
+	Checkpoints genetics.Checkpointer
+	Resume      bool
+	// CacheDir keeps the fitness of the genomes evaluated for later runs on
+	// the same data, they're only cached for the run when empty
+	CacheDir string
+
+	// period of the training data, checkpointed to resume on the same data
+	from, to time.Time
+}
+
+// GeneticsRun trains a genome on the last days of the asset against the costs,
+// with the funding rates bc fetches, none when nil
+func GeneticsRun(days int, asset string, cfg genetics.Config, costs strategies.Costs, bc *connectors.BinanceConnector) error {
+	return GeneticsRunWith(days, asset, cfg, costs, bc, RunOptions{})
+}
+
+// GeneticsRunWith is GeneticsRun with options
+func GeneticsRunWith(days int, asset string, cfg genetics.Config, costs strategies.Costs, bc *connectors.BinanceConnector, opts RunOptions) error {
+	snapshots, err := trainingData(days, asset, opts)
+	if err != nil {
+		return fmt.Errorf("geneticsRun: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("geneticsRun: no %s data to train on", asset)
+	}
+	opts.from = snapshots[0].Date
+	opts.to = snapshots[len(snapshots)-1].Date.Add(time.Minute)
+
+	problem := &training.ScalpingProblem{Series: strategies.NewSeries(snapshots)}
+	problem.Costs = withFunding(bc, costs, asset, snapshots)
+
+	weights, best, cfg, stats, err := train(problem, asset, cfg, opts)
+	if err != nil {
+		return fmt.Errorf("geneticsRun: %w", err)
+	}
+	id, err := db.StoreWeights(asset, weights, best.Value, cfg, true)
+	if err != nil {
+		return fmt.Errorf("geneticsRun: %w", err)
+	}
+	storeStats(id, stats)
+
+	// only now that the genome is stored can resuming skip the asset
+	if opts.Checkpoints != nil {
+		err = genetics.MarkDone(opts.Checkpoints)
+		if err != nil {
+			log.Printf("Error marking checkpoint done: %v", err)
+		}
+	}
+	return nil
+}
+
+// trainingData returns the snapshots of the last days of the asset, or those
+// of the checkpoint when resuming, as newer snapshots came in since
+func trainingData(days int, a string, opts RunOptions) ([]*asset.Snapshot, error) {
+	if opts.Resume && opts.Checkpoints != nil {
+		state, err := opts.Checkpoints.Load()
+		if err != nil {
+			return nil, fmt.Errorf("trainingData: %w", err)
+		}
+		if state != nil && !state.To.IsZero() {
+			log.Printf("Resuming %s on its data from %v to %v", a, state.From, state.To)
+			snapshots, err := repositories.GetSnapshotsBetween(db.GetDb(), a, state.From, state.To)
+			if err != nil {
+				return nil, fmt.Errorf("trainingData: %w", err)
+			}
+			return snapshots, nil
+		}
+	}
+
+	repo, err := repositories.NewDBRepository(a, 24*60*days+60)
+	if err != nil {
+		return nil, fmt.Errorf("trainingData: %w", err)
+	}
+	snapshots, err := repo.Get(a)
+	if err != nil {
+		return nil, fmt.Errorf("trainingData: %w", err)
+	}
+	return helper.ChanToSlice(snapshots), nil
+}
+
+// PromotionRun trains a candidate genome on the days of snapshots before the
+// last holdout minutes, and only promotes it to the active genome if it passes
+// the gate on the holdout. It reports whether the candidate was promoted.
+func PromotionRun(days, holdout int, asset string, cfg genetics.Config, costs strategies.Costs, bc *connectors.BinanceConnector, gate training.Gate, fallback *strategies.StrategyWeights) (bool, error) {
+	historyMinutes := 24 * 60 * days
+	repo, err := repositories.NewDBRepository(asset, historyMinutes+holdout+60)
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+
+	snapshots, err := repo.Get(asset)
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+
+	all := helper.ChanToSlice(snapshots)
+	trainSet, holdoutSet, err := training.Holdout(all, holdout)
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+
+	gate.Costs = withFunding(bc, costs, asset, all)
+	problem := &training.ScalpingProblem{Series: strategies.NewSeries(trainSet), Costs: gate.Costs}
+	weights, best, cfg, stats, err := train(problem, asset, cfg, RunOptions{})
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+
+	active := fallback
+	g, err := db.GetLatestGenome(asset)
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+	if g != nil {
+		active = &g.Weights
+	}
+
+	m, err := gate.Check(weights, active, holdoutSet)
+	promoted := err == nil
+	if promoted {
+		log.Printf("[%s] Promoting candidate: holdout PnL %.2f over %d trades, profit factor %.2f", asset, m.PnL, m.Trades, m.ProfitFactor)
+	} else {
+		log.Printf("[%s] Keeping the active genome, candidate rejected on holdout: %v", asset, err)
+	}
+
+	id, err := db.StoreWeights(asset, weights, best.Value, cfg, promoted)
+	if err != nil {
+		return false, fmt.Errorf("promotionRun: %w", err)
+	}
+	storeStats(id, stats)
+
+	return promoted, nil
 }
-func GeneticsRun(days int, asset string) {
+
+// ParetoRun trains the objectives of the config together, stores the Pareto
+// front and promotes the solution the rule picks, if any meets its constraints
+func ParetoRun(days int, asset string, cfg genetics.Config, costs strategies.Costs, bc *connectors.BinanceConnector, rule training.Rule) {
 	historyMinutes := 24 * 60 * days
 	repo, err := repositories.NewDBRepository(asset, historyMinutes+60)
 	if err != nil {
 		log.Fatalf("Error creating repository: %v", err)
 	}
 
-	best, err := genetics.RunGenetic(repo, asset)
+	problem, err := training.NewScalpingProblem(repo, asset)
+	if err != nil {
+		log.Fatalf("Error loading training data: %v", err)
+	}
+
+	problem.Costs = withFunding(bc, costs, asset, problem.Series.Snapshots)
+	problem.Objectives, err = training.NewObjectives(cfg.Objectives, cfg.MinTrades)
+	if err != nil {
+		log.Fatalf("Error creating objectives: %v", err)
+	}
+
+	cfg = cfg.Seeded()
+	log.Printf("Training %s with seed %d on objectives %v", asset, cfg.Seed, cfg.Objectives)
+	front, err := genetics.RunNSGA2(problem, cfg)
+	if err != nil {
+		log.Fatalf("Error running NSGA-II: %v", err)
+	}
+
+	chosen, err := rule.Pick(problem.Objectives, front)
 	if err != nil {
-		log.Fatalf("Error running genetic algorithm: %v", err)
+		log.Printf("[%s] Keeping the active genome: %v", asset, err)
+		chosen = -1
+	}
+
+	members := make([]db.ParetoMember, len(front))
+	for i, s := range front {
+		values := training.Values(problem.Objectives, s)
+		members[i] = db.ParetoMember{
+			Weights:    strategies.WeightsFromParams(s.Individual),
+			Fitness:    values[rule.Best],
+			Objectives: values,
+		}
+
+		mark := " "
+		if i == chosen {
+			mark = "*"
+		}
+		fmt.Printf("%s %v\n", mark, values)
 	}
 
-	log.Printf("Best strategy: %+v", best)
-	err = db.StoreWeights(asset, best)
+	err = db.StoreParetoFront(asset, members, chosen, cfg)
+	if err != nil {
+		log.Fatalf("Error storing Pareto front: %v", err)
+	}
+}
+
+// RobustRun trains a single genome over the last days of every asset of the
+// config, split in its windows, and stores it as the universal genome
+func RobustRun(days int, cfg genetics.Config, costs strategies.Costs, bc *connectors.BinanceConnector, opts RunOptions) {
+	aggregate, err := training.NewAggregation(cfg.Aggregation)
+	if err != nil {
+		log.Fatalf("Error creating aggregation: %v", err)
+	}
+	err = training.RobustFitness(cfg.Fitness)
+	if err != nil {
+		log.Fatalf("Invalid robust fitness: %v", err)
+	}
+
+	problem := &training.RobustProblem{Aggregate: aggregate}
+	for _, a := range cfg.Assets {
+		repo, err := repositories.NewDBRepository(a, 24*60*days+60)
+		if err != nil {
+			log.Fatalf("Error creating repository: %v", err)
+		}
+
+		snapshots, err := repo.Get(a)
+		if err != nil {
+			log.Fatalf("Error getting %s data: %v", a, err)
+		}
+
+		all := helper.ChanToSlice(snapshots)
+		windows, err := training.Windows(all, cfg.Windows)
+		if err != nil {
+			log.Fatalf("Error splitting %s data: %v", a, err)
+		}
+		funded := withFunding(bc, costs, a, all)
+		for _, w := range windows {
+			problem.Series = append(problem.Series, strategies.NewSeries(w))
+			problem.Costs = append(problem.Costs, funded)
+		}
+	}
+
+	log.Printf("Training a universal genome over %d datasets, %s fitness", len(problem.Series), cfg.Aggregation)
+	weights, best, cfg, stats, err := train(problem, db.UniversalAsset, cfg, opts)
+	if err != nil {
+		log.Fatalf("Error training the universal genome: %v", err)
+	}
+	id, err := db.StoreWeights(db.UniversalAsset, weights, best.Value, cfg, true)
 	if err != nil {
 		log.Fatalf("Error storing weights: %v", err)
 	}
+	storeStats(id, stats)
+}
+
+// WithFunding returns the costs with the funding rates of the asset over the
+// snapshots, fetched with bc. Without a connector the costs are returned as is.
+func WithFunding(bc *connectors.BinanceConnector, costs strategies.Costs, a string, snapshots []*asset.Snapshot) (strategies.Costs, error) {
+	if bc == nil || len(snapshots) == 0 {
+		return costs, nil
+	}
+
+	rates, err := bc.GetFundingRates(a, snapshots[0].Date, snapshots[len(snapshots)-1].Date)
+	if err != nil {
+		return costs, fmt.Errorf("withFunding: %w", err)
+	}
+
+	costs.Funding = rates
+	return costs, nil
+}
+
+// withFunding is WithFunding training without funding when the rates can't be
+// fetched, which isn't worth failing a run, let alone live trading, over
+func withFunding(bc *connectors.BinanceConnector, costs strategies.Costs, a string, snapshots []*asset.Snapshot) strategies.Costs {
+	funded, err := WithFunding(bc, costs, a, snapshots)
+	if err != nil {
+		log.Printf("[%s] Error getting funding rates, going on without funding: %v", a, err)
+	}
+	return funded
+}
+
+// storeStats stores the convergence of a training run, which isn't worth
+// failing the run over
+func storeStats(genomeID int, stats []genetics.GenerationStats) {
+	err := db.StoreTrainingStats(genomeID, stats)
+	if err != nil {
+		log.Printf("Error storing training stats: %v", err)
+	}
+}
+
+// train runs the optimiser of the config, returning the best weights, their
+// score, the config with its seed and the stats of each generation, for the GA
+func train(problem training.FittedProblem, asset string, cfg genetics.Config, opts RunOptions) (strategies.StrategyWeights, *genetics.Score, genetics.Config, []genetics.GenerationStats, error) {
+	cp := opts.Checkpoints
+	if opts.Resume {
+		state, err := cp.Load()
+		if err != nil {
+			return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: %w", err)
+		}
+		// the run goes on with the settings it started with
+		if state != nil {
+			cfg = state.Config
+		}
+	}
+
+	cfg = cfg.Seeded()
+	log.Printf("Training %s with %s, seed %d and %s fitness", asset, cfg.Optimizer, cfg.Seed, cfg.Fitness)
+	fitness, err := training.NewFitness(cfg.Fitness, cfg.MinTrades)
+	if err != nil {
+		return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: %w", err)
+	}
+	problem.SetFitness(fitness)
+
+	optimizer, err := optimizers.New(cfg.Optimizer)
+	if err != nil {
+		return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: %w", err)
+	}
+	// the score of a genome only depends on the scoring code, the genes, the
+	// data and the fitness settings
+	dataset := fmt.Sprintf("v%d|%s|%s|%s|%d|%s", training.ScoringVersion, problem.Space().ID(), problem.Dataset(), cfg.Fitness, cfg.MinTrades, cfg.Aggregation)
+
+	var stats []genetics.GenerationStats
+	if _, ok := optimizer.(optimizers.GA); ok {
+		optimizer = optimizers.GA{Options: genetics.Options{
+			Checkpoints: cp,
+			Resume:      opts.Resume,
+			Dataset:     dataset,
+			From:        opts.from,
+			To:          opts.to,
+			OnGeneration: func(s genetics.GenerationStats) {
+				stats = append(stats, s)
+			},
+		}}
+	} else if cp != nil {
+		return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: checkpoints are only supported by the ga optimizer, not %s", cfg.Optimizer)
+	}
+
+	cache := genetics.NewCache(problem, dataset)
+	if opts.CacheDir != "" {
+		err = cache.Load(opts.CacheDir)
+		if err != nil {
+			return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: %w", err)
+		}
+	}
+
+	best, err := optimizer.Optimize(cache, cfg)
+	if err != nil {
+		return strategies.StrategyWeights{}, nil, cfg, nil, fmt.Errorf("train: %s optimizer: %w", cfg.Optimizer, err)
+	}
+
+	hits, misses := cache.Counts()
+	log.Printf("Fitness cache: %d hits out of %d evaluations (%.1f%%)", hits, hits+misses, cache.HitRate()*100)
+	if opts.CacheDir != "" {
+		err = cache.Save(opts.CacheDir)
+		if err != nil {
+			log.Printf("Error saving fitness cache: %v", err)
+		}
+	}
+
+	weights := strategies.WeightsFromParams(best.Individual)
+	log.Printf("Best strategy: %+v", weights)
+
+	return weights, best, cfg, stats, nil
 }
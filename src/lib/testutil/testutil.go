@@ -0,0 +1,34 @@
+// Package testutil holds the fixtures shared by the tests of several packages.
+package testutil
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/cinar/indicator/v2/asset"
+)
+
+// RandomWalk generates minute snapshots of a noisy trending price, the same
+// ones on every call
+func RandomWalk(n int) []*asset.Snapshot {
+	r := rand.New(rand.NewPCG(1, 2))
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	price := 100.0
+
+	snapshots := make([]*asset.Snapshot, n)
+	for i := range snapshots {
+		open := price
+		price += math.Sin(float64(i)/90)*0.05 + r.NormFloat64()*0.2
+		snapshots[i] = &asset.Snapshot{
+			Date:   start.Add(time.Duration(i) * time.Minute),
+			Open:   open,
+			High:   math.Max(open, price) + r.Float64()*0.1,
+			Low:    math.Min(open, price) - r.Float64()*0.1,
+			Close:  price,
+			Volume: 1,
+		}
+	}
+
+	return snapshots
+}
@@ -1,46 +1,88 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/cinar/indicator/v2/helper"
 	"github.com/cinar/indicator/v2/strategy"
 	"pivetta.se/crypro-spotter/src/connectors"
+	"pivetta.se/crypro-spotter/src/genetics"
 	"pivetta.se/crypro-spotter/src/lib/db"
 	"pivetta.se/crypro-spotter/src/lib/helpers"
+	"pivetta.se/crypro-spotter/src/optimizers"
+	"pivetta.se/crypro-spotter/src/repositories"
+	"pivetta.se/crypro-spotter/src/risk"
+	"pivetta.se/crypro-spotter/src/sizing"
 	"pivetta.se/crypro-spotter/src/strategies"
+	"pivetta.se/crypro-spotter/src/training"
 )
 
-// yes i know, global bad
-var outcome float64
-var asset *string
+type trader struct {
+	asset    string
+	bc       *connectors.BinanceConnector
+	trade    bool
+	gaConfig genetics.Config
+	fallback *strategies.StrategyWeights
+	risk     *risk.Manager
+	sizer    sizing.Sizer
+	genomeID int
+	// minutes of recent data a new genome is validated on, 0 to promote it untested
+	holdout int
+	gate    training.Gate
+	// latestGenome looks up the active genome of an asset, db.GetLatestGenome when nil
+	latestGenome func(a string) (*db.Genome, error)
+	// costs genomes are trained against
+	costs strategies.Costs
+
+	// open position, with the highest and lowest prices seen since entry
+	pos  *strategies.Trade
+	high float64
+	low  float64
+	// last price seen, to flatten the position at when trading stops
+	last float64
+	// PnL of the closed trades, for sizers learning from past performance
+	pnls []float64
+
+	mu      sync.Mutex
+	outcome float64
+}
 
 func main() {
-	// Create a channel to listen for OS signals
-	sigChan := make(chan os.Signal, 1)
-	// Notify the channel when receiving an Interrupt (Ctrl+C) or Termination signal
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	// Run a goroutine to handle the signal
-	go func() {
-		sig := <-sigChan
-		fmt.Println("\nReceived signal:", sig)
-		cleanup()
-		os.Exit(0)
-	}()
-
-	asset = flag.String("asset", "BTCUSDT", "Asset to backtest")
+	assets := flag.String("assets", "BTCUSDT", "Comma separated assets to trade")
+	defaultWeights := flag.String("default-weights", "", "Weights (genome JSON) to trade with when no genome is stored for an asset")
+	rateLimit := flag.Int("rate-limit", 600, "Max requests per minute shared by all assets")
+	maxNotional := flag.Float64("max-notional", 0, "Max notional (USDT) open across all assets, 0 for no limit")
+	maxDailyLoss := flag.Float64("max-daily-loss", 0, "Halt trading for the day once losses (USDT) reach this, 0 for no limit")
+	maxLosses := flag.Int("max-consecutive-losses", 0, "Halt trading after this many losing trades in a row, 0 for no limit")
+	maxOrders := flag.Int("max-orders-per-hour", 0, "Max orders opening a position per hour across all assets, 0 for no limit")
+	killFile := flag.String("kill-file", "", "Halt trading and flatten positions while this file exists")
+	riskAddr := flag.String("risk-addr", "", "Address to serve the risk status and kill switch on, e.g. :8080 for localhost:8080")
+	sizerName := flag.String("sizer", "fixed", "Position sizer: fixed, percent, risk or kelly")
+	size := flag.Float64("size", 250, "Sizer setting: USDT notional for fixed, % of balance for percent, % of balance risked for risk, Kelly fraction for kelly")
+	holdoutHours := flag.Int("holdout-hours", 6, "Hours of recent data held out of training to validate new genomes on, 0 to promote every new genome")
+	minTrades := flag.Int("min-trades", 5, "Min trades a new genome must make on the holdout to be promoted")
+	minProfitFactor := flag.Float64("min-profit-factor", 1.1, "Min profit factor a new genome must reach on the holdout to be promoted")
+	maxDrawdown := flag.Float64("max-drawdown", 2, "Max drawdown (% of price) a new genome may have on the holdout to be promoted, 0 for no limit")
+	gaConfig := genetics.ConfigFlags()
+	costs := strategies.CostFlags()
 	flag.Parse()
 	apiKey := os.Getenv("API_KEY")
 	apiSecret := os.Getenv("API_SECRET")
 	mode := os.Getenv("MODE")
 	skip := os.Getenv("SKIP")
 	trade := os.Getenv("TRADE")
+	riskToken := os.Getenv("RISK_TOKEN")
 
 	url := connectors.TESTNET
 	if mode == "live" {
@@ -52,20 +94,180 @@ func main() {
 		log.Fatalf("API_KEY and API_SECRET must be set")
 	}
 
-	bc := connectors.BinanceConnector{
-		Url:    url,
-		Key:    apiKey,
-		Secret: apiSecret,
+	err := gaConfig.Validate()
+	if err != nil {
+		log.Fatalf("Invalid GA settings: %v", err)
 	}
-	db := db.GetDb()
 
+	_, err = optimizers.New(gaConfig.Optimizer)
+	if err != nil {
+		log.Fatalf("Invalid GA settings: %v", err)
+	}
+	// the daily retrain promotes a single genome through the gate
+	if len(gaConfig.Objectives) > 0 {
+		log.Fatalf("Invalid GA settings: --objectives is only supported by the train command")
+	}
+
+	sizer, err := sizing.New(*sizerName, *size)
+	if err != nil {
+		log.Fatalf("Error creating sizer: %v", err)
+	}
+
+	var fallback *strategies.StrategyWeights
+	if *defaultWeights != "" {
+		err := json.Unmarshal([]byte(*defaultWeights), &fallback)
+		if err != nil {
+			log.Fatalf("Error parsing default weights: %v", err)
+		}
+	}
+
+	limiter, err := connectors.NewRateLimiter(*rateLimit)
+	if err != nil {
+		log.Fatalf("Invalid --rate-limit: %v", err)
+	}
+	bc := &connectors.BinanceConnector{
+		Url:     url,
+		Key:     apiKey,
+		Secret:  apiSecret,
+		Limiter: limiter,
+	}
+	rm := risk.NewManager(risk.Limits{
+		MaxDailyLoss:         *maxDailyLoss,
+		MaxConsecutiveLosses: *maxLosses,
+		MaxOpenNotional:      *maxNotional,
+		MaxOrdersPerHour:     *maxOrders,
+		KillSwitchFile:       *killFile,
+	})
+
+	if *riskAddr != "" {
+		addr, err := localAddr(*riskAddr)
+		if err != nil {
+			log.Fatalf("Invalid --risk-addr: %v", err)
+		}
+		if riskToken == "" {
+			log.Printf("RISK_TOKEN not set, the kill switch can't be triggered nor lifted over HTTP")
+		}
+
+		go func() {
+			log.Printf("Serving risk kill switch on %s", addr)
+			err := http.ListenAndServe(addr, rm.Handler(riskToken))
+			if err != nil {
+				log.Fatalf("Error serving kill switch: %v", err)
+			}
+		}()
+	}
+
+	var traders []*trader
+	for _, a := range strings.Split(*assets, ",") {
+		traders = append(traders, &trader{
+			asset:    strings.TrimSpace(a),
+			bc:       bc,
+			trade:    trade == "true",
+			fallback: fallback,
+			gaConfig: *gaConfig,
+			risk:     rm,
+			sizer:    sizer,
+			holdout:  *holdoutHours * 60,
+			gate: training.Gate{
+				MinTrades:       *minTrades,
+				MinProfitFactor: *minProfitFactor,
+				MaxDrawdown:     *maxDrawdown,
+			},
+			costs: *costs,
+		})
+	}
+
+	// Create a channel to listen for OS signals
+	sigChan := make(chan os.Signal, 1)
+	// Notify the channel when receiving an Interrupt (Ctrl+C) or Termination signal
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Run a goroutine to handle the signal
+	go func() {
+		sig := <-sigChan
+		fmt.Println("\nReceived signal:", sig)
+		for _, t := range traders {
+			t.cleanup()
+		}
+		os.Exit(0)
+	}()
+
+	var wg sync.WaitGroup
+	for _, t := range traders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.run(skip != "true")
+		}()
+	}
+	wg.Wait()
+}
+
+// run trades the asset forever, retraining its genome once a day. An asset
+// with no genome to trade, e.g. because its first one was rejected on the
+// holdout, sits out until the next retrain, or for good without retraining.
+// An asset failing to trade sits out until tomorrow, leaving the others be.
+func (t *trader) run(retrain bool) {
 	for {
-		if skip != "true" {
-			helpers.FetchSnapshots(db, *asset, bc)
-			helpers.GeneticsRun(3, *asset)
+		if retrain {
+			err := t.retrain()
+			if err != nil {
+				log.Printf("[%s] Error retraining, trading the active genome: %v", t.asset, err)
+			}
+		}
+
+		err := t.liveRun()
+		if errors.Is(err, errNoGenome) {
+			t.stop()
+			if !retrain {
+				log.Printf("[%s] Not trading: %v", t.asset, err)
+				return
+			}
+			log.Printf("[%s] Not trading until tomorrow's retrain: %v", t.asset, err)
+			time.Sleep(time.Until(tomorrow()))
+			continue
 		}
-		liveRun(bc, *asset, trade == "true")
+		if err != nil {
+			t.stop()
+			log.Printf("[%s] Error trading, backing off until tomorrow: %v", t.asset, err)
+			time.Sleep(time.Until(tomorrow()))
+		}
+	}
+}
+
+// retrain fetches the latest snapshots of the asset and trains its next genome
+func (t *trader) retrain() error {
+	err := helpers.FetchSnapshots(db.GetDb(), t.asset, *t.bc)
+	if err != nil {
+		return fmt.Errorf("retrain: %w", err)
 	}
+
+	if t.holdout > 0 {
+		_, err = helpers.PromotionRun(3, t.holdout, t.asset, t.gaConfig, t.costs, t.bc, t.gate, t.fallback)
+	} else {
+		err = helpers.GeneticsRun(3, t.asset, t.gaConfig, t.costs, t.bc)
+	}
+	if err != nil {
+		return fmt.Errorf("retrain: %w", err)
+	}
+	return nil
+}
+
+// stop flattens the open position of an asset that stops trading for now
+func (t *trader) stop() {
+	if t.pos == nil {
+		return
+	}
+
+	err := t.flatten(t.last, strategies.ExitError)
+	if err != nil {
+		log.Printf("[%s] Error closing position before backing off, trading halted: %v", t.asset, err)
+	}
+}
+
+// tomorrow returns the next local midnight
+func tomorrow() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
 }
 
 // func main() {
@@ -94,18 +296,24 @@ func main() {
 
 // }
 
-func liveRun(bc connectors.BinanceConnector, asset string, trade bool) {
+// liveRun trades the asset until the end of the day
+func (t *trader) liveRun() error {
 	now := time.Now()
 	startDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
 
-	bd, err := bc.Poll(asset)
+	latest := t.latestGenome
+	if latest == nil {
+		latest = db.GetLatestGenome
+	}
+	w, genomeID, err := loadWeights(t.asset, t.fallback, latest)
 	if err != nil {
-		log.Fatalf("Error polling Binance: %v", err)
+		return fmt.Errorf("liveRun: %w", err)
 	}
+	t.genomeID = genomeID
 
-	w, err := db.GetLatestWeights("BTCUSDT")
+	bd, err := t.bc.Poll(t.asset)
 	if err != nil {
-		log.Fatalf("Error getting weights: %v", err)
+		return fmt.Errorf("liveRun, poll: %w", err)
 	}
 
 	scalp := strategies.Scalping{
@@ -114,96 +322,254 @@ func liveRun(bc connectors.BinanceConnector, asset string, trade bool) {
 		WithSL:        true,
 	}
 
-	ss := helper.Duplicate(bd.Klines, 2)
-	ac, oc := scalp.ComputeWithOutcome(ss[0], true)
-
-	var pos *strategies.Position
-	for a := range ac {
-		kline := <-ss[1]
-		outcome = <-oc
-		log.Printf("Action: %v, Price: %.2f, Outcome: %.2f", extendedAnnotation(a), kline.Close, outcome)
+	for step := range scalp.Simulate(bd.Klines, true) {
+		a := step.Action
+		kline := step.Snapshot
+		t.mu.Lock()
+		t.outcome = step.Outcome
+		t.mu.Unlock()
+		log.Printf("[%s] Action: %v, Price: %.2f, Outcome: %.2f", t.asset, extendedAnnotation(a), kline.Close, step.Outcome)
+		t.last = kline.Close
+
+		if t.pos != nil {
+			t.high = max(t.high, kline.High)
+			t.low = min(t.low, kline.Low)
+		}
 
 		// we should run the compute until midnight, store the outcome and retrain the weights
 		if time.Since(startDate) >= 24*time.Hour {
-			log.Printf("End of day, retraining weights")
-			if pos != nil {
-				// generate opposite order to close position
-				var orderType connectors.Side
-				if pos.Type == strategies.LONG {
-					orderType = connectors.SELL
-				} else {
-					orderType = connectors.BUY
-				}
-
-				err := bc.PlaceOrder(asset, orderType, helpers.CalculateQuantity(250, pos.EntryPrice))
+			log.Printf("[%s] End of day, retraining weights", t.asset)
+			if t.pos != nil {
+				err := t.flatten(kline.Close, strategies.ExitEndOfDay)
 				if err != nil {
-					// figure what to do here, serious here
-					log.Printf("Error placing order: %v", err)
-				} else {
-					pos = nil
+					log.Printf("[%s] Error closing position at the end of the day, trading halted until it's closed: %v", t.asset, err)
 				}
 			}
 
 			break
 		}
 
-		if !trade {
+		if !t.trade {
 			continue
 		}
 
-		if a == strategy.Buy {
-			err := bc.PlaceOrder(asset, connectors.BUY, helpers.CalculateQuantity(250, kline.Close))
-			if err != nil {
-				// figure what to do here
-				log.Printf("Error placing order: %v", err)
-			} else {
-				log.Printf("Placed order: %v", asset)
-				pos = &strategies.Position{
-					Type:       strategies.LONG,
-					EntryPrice: kline.Close,
-					EntryTime:  time.Now(),
+		if reason := t.risk.Halted(); reason != "" {
+			if t.pos != nil {
+				log.Printf("[%s] Trading halted (%s), flattening position", t.asset, reason)
+				err := t.flatten(kline.Close, strategies.ExitRiskHalt)
+				if err != nil {
+					log.Printf("[%s] Error flattening position, retrying on the next kline: %v", t.asset, err)
 				}
 			}
-		} else if a == strategy.Sell {
-			err := bc.PlaceOrder(asset, connectors.SELL, helpers.CalculateQuantity(250, kline.Close))
+			continue
+		}
+
+		if (a == strategy.Buy || a == strategy.Sell) && t.pos == nil {
+			quantity, err := t.quantity(scalp, step)
 			if err != nil {
-				// figure what to do here
-				log.Printf("Error placing order: %v", err)
-			} else {
-				log.Printf("Placed order: %v", asset)
-				pos = &strategies.Position{
-					Type:       strategies.SHORT,
-					EntryPrice: kline.Close,
-					EntryTime:  time.Now(),
-				}
+				log.Printf("[%s] Error sizing position: %v", t.asset, err)
+				continue
+			}
+
+			if quantity <= 0 {
+				log.Printf("[%s] Sizer returned no quantity, skipping order", t.asset)
+				continue
+			}
+
+			err = t.risk.AllowOrder(t.asset, quantity*kline.Close)
+			if err != nil {
+				log.Printf("[%s] Order rejected by risk manager: %v", t.asset, err)
+				continue
+			}
+
+			side, posType := connectors.BUY, strategies.LONG
+			if a == strategy.Sell {
+				side, posType = connectors.SELL, strategies.SHORT
 			}
-		} else if a == strategies.Close && pos != nil {
-			// generate opposite order to close position
-			var orderType connectors.Side
-			if pos.Type == strategies.LONG {
-				orderType = connectors.SELL
-			} else {
-				orderType = connectors.BUY
+
+			order, err := t.bc.PlaceOrder(t.asset, side, quantity)
+			if err != nil {
+				// figure what to do here
+				log.Printf("[%s] Error placing order: %v", t.asset, err)
+				t.risk.Release(t.asset)
+				continue
 			}
 
-			err := bc.PlaceOrder(asset, orderType, helpers.CalculateQuantity(250, pos.EntryPrice))
+			log.Printf("Placed order: %v", t.asset)
+			t.journalOrder(order, kline.Close)
+			if order.ExecutedQty <= 0 {
+				log.Printf("[%s] Order %d filled nothing, no position opened", t.asset, order.ID)
+				t.risk.Release(t.asset)
+				continue
+			}
+			t.pos = &strategies.Trade{
+				Position: strategies.Position{
+					Type:       posType,
+					Quantity:   order.ExecutedQty,
+					EntryTime:  time.Now(),
+					EntryPrice: order.AvgPrice,
+				},
+				Fees: order.Fees,
+			}
+			t.high = order.AvgPrice
+			t.low = order.AvgPrice
+			t.last = order.AvgPrice
+		} else if a == strategies.Close && t.pos != nil {
+			err := t.flatten(kline.Close, step.Reason)
 			if err != nil {
-				// figure what to do here, serious here
-				log.Printf("Error placing order: %v", err)
-			} else {
-				pos = nil
+				log.Printf("[%s] Error closing position, trading halted until it's closed: %v", t.asset, err)
 			}
 		}
 	}
 
-	cleanup()
+	t.cleanup()
+	return nil
 }
 
-func cleanup() {
-	log.Println("Trade results:", outcome)
-	err := storeOutcome(*asset, outcome)
+// closePosition generates the opposite order to close the open position and
+// journals the round trip
+func (t *trader) closePosition(price float64, reason strategies.ExitReason) error {
+	var orderType connectors.Side
+	if t.pos.Type == strategies.LONG {
+		orderType = connectors.SELL
+	} else {
+		orderType = connectors.BUY
+	}
+
+	order, err := t.bc.PlaceOrder(t.asset, orderType, t.pos.Quantity)
+	if err != nil {
+		// figure what to do here, serious here
+		log.Printf("[%s] Error placing order: %v", t.asset, err)
+		return err
+	}
+
+	t.journalOrder(order, price)
+	t.pos.Fees += order.Fees
+	// what didn't fill is still open, and closed by the next attempt
+	if order.ExecutedQty < t.pos.Quantity {
+		t.pos.Quantity -= order.ExecutedQty
+		return fmt.Errorf("closePosition: closed %v, %v still open", order.ExecutedQty, t.pos.Quantity)
+	}
+	t.pos.Close(time.Now(), order.AvgPrice, t.high, t.low, reason)
+	err = repositories.InsertTrade(db.GetDb(), t.asset, repositories.SourceLive, t.genomeID, *t.pos)
+	if err != nil {
+		log.Printf("[%s] Error journaling trade: %v", t.asset, err)
+	}
+
+	t.pnls = append(t.pnls, t.pos.PnL)
+	t.risk.RecordTrade(t.pos.PnL)
+	t.risk.Release(t.asset)
+	t.pos = nil
+	return nil
+}
+
+// retryDelay grows between attempts at closing a position
+var retryDelay = time.Second
+
+// flatten closes the open position, retrying a few times before halting
+// trading, which then retries closing it on every kline
+func (t *trader) flatten(price float64, reason strategies.ExitReason) error {
+	var err error
+	for attempt := range 3 {
+		time.Sleep(time.Duration(attempt) * retryDelay)
+		err = t.closePosition(price, reason)
+		if err == nil {
+			return nil
+		}
+	}
+
+	t.risk.Kill(fmt.Sprintf("couldn't close the %s position: %v", t.asset, err))
+	return fmt.Errorf("flatten: %w", err)
+}
+
+// quantity sizes a new position against the current account balance
+func (t *trader) quantity(scalp strategies.Scalping, step strategies.Step) (float64, error) {
+	balance, err := t.bc.GetBalance()
+	if err != nil {
+		return 0, err
+	}
+
+	return t.sizer.Quantity(sizing.Context{
+		Price:        step.Snapshot.Close,
+		Balance:      balance,
+		Atr:          step.Atr,
+		StopDistance: scalp.StopDistance(step.Atr),
+		RecentPnL:    t.pnls,
+	}), nil
+}
+
+func (t *trader) journalOrder(order *connectors.Order, requestedPrice float64) {
+	err := repositories.InsertOrder(db.GetDb(), t.asset, repositories.SourceLive, t.genomeID, repositories.JournalOrder{
+		ExchangeID:     order.ID,
+		Date:           time.Now(),
+		Side:           string(order.Side),
+		Quantity:       order.ExecutedQty,
+		RequestedPrice: requestedPrice,
+		FillPrice:      order.AvgPrice,
+		Fees:           order.Fees,
+		Status:         order.Status,
+	})
+	if err != nil {
+		log.Printf("[%s] Error journaling order %d: %v", t.asset, order.ID, err)
+	}
+}
+
+// localAddr binds addresses without a host to localhost, the kill switch
+// mustn't be reachable from other hosts unless asked for
+func localAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("localAddr: %w", err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// errNoGenome is returned when an asset has no promoted genome nor default weights
+var errNoGenome = errors.New("no genome stored")
+
+// loadWeights returns the active genome for the asset, or the universal genome
+// then the fallback weights when none has been trained yet.
+func loadWeights(asset string, fallback *strategies.StrategyWeights, latest func(a string) (*db.Genome, error)) (*strategies.StrategyWeights, int, error) {
+	g, err := latest(asset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if g == nil && asset != db.UniversalAsset {
+		g, err = latest(db.UniversalAsset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if g != nil {
+			log.Printf("No genome stored for %s, trading the universal genome", asset)
+		}
+	}
+
+	if g == nil {
+		if fallback == nil {
+			return nil, 0, fmt.Errorf("%w for %s, train one first or pass --default-weights", errNoGenome, asset)
+		}
+
+		log.Printf("No genome stored for %s, trading with default weights: %+v", asset, *fallback)
+		return fallback, 0, nil
+	}
+
+	log.Printf("Trading %s with genome %d (trained %s, fitness %.2f): %+v", asset, g.ID, g.Date.Format(time.DateTime), g.Fitness, g.Weights)
+	return &g.Weights, g.ID, nil
+}
+
+func (t *trader) cleanup() {
+	t.mu.Lock()
+	outcome := t.outcome
+	t.mu.Unlock()
+
+	log.Printf("[%s] Trade results: %v", t.asset, outcome)
+	err := storeOutcome(t.asset, outcome)
 	if err != nil {
-		log.Fatalf("Error storing outcome: %v", err)
+		log.Printf("[%s] Error storing outcome: %v", t.asset, err)
 	}
 }
 
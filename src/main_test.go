@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pivetta.se/crypro-spotter/src/connectors"
+	"pivetta.se/crypro-spotter/src/lib/db"
+	"pivetta.se/crypro-spotter/src/risk"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// promoted looks genomes up among the promoted ones given by asset
+func promoted(genomes map[string]*db.Genome) func(a string) (*db.Genome, error) {
+	return func(a string) (*db.Genome, error) {
+		return genomes[a], nil
+	}
+}
+
+// the first genome of an asset was rejected on the holdout, so only
+// unpromoted genomes are stored and none is active
+func TestFirstGenomeRejected(t *testing.T) {
+	tr := &trader{asset: "BTCUSDT", latestGenome: promoted(nil)}
+
+	err := tr.liveRun()
+	if !errors.Is(err, errNoGenome) {
+		t.Fatalf("got %v, expected no genome", err)
+	}
+
+	// without retraining the asset stops, leaving the other traders running
+	tr.run(false)
+}
+
+func TestLoadWeightsFallsBack(t *testing.T) {
+	universal := &db.Genome{ID: 7, Asset: db.UniversalAsset, Weights: strategies.DefaultWeights}
+	w, id, err := loadWeights("BTCUSDT", nil, promoted(map[string]*db.Genome{db.UniversalAsset: universal}))
+	if err != nil || id != 7 || *w != universal.Weights {
+		t.Fatalf("got genome %d, %v, expected the universal one", id, err)
+	}
+
+	fallback := strategies.DefaultWeights
+	fallback.RsiWeight = 3
+	w, id, err = loadWeights("BTCUSDT", &fallback, promoted(nil))
+	if err != nil || id != 0 || *w != fallback {
+		t.Fatalf("got genome %d %+v, %v, expected the default weights", id, w, err)
+	}
+}
+
+func TestFlattenHaltsWhenCloseFails(t *testing.T) {
+	retryDelay = 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":-1001,"msg":"Internal error"}`)
+	}))
+	defer server.Close()
+
+	tr := &trader{
+		asset: "BTCUSDT",
+		bc:    &connectors.BinanceConnector{Url: server.URL},
+		risk:  risk.NewManager(risk.Limits{}),
+		pos:   &strategies.Trade{Position: strategies.Position{Type: strategies.LONG, Quantity: 0.01, EntryPrice: 100}},
+	}
+	err := tr.flatten(101, strategies.ExitEndOfDay)
+	if err == nil {
+		t.Fatal("flattened through a failing exchange")
+	}
+	if tr.pos == nil || tr.risk.Halted() == "" {
+		t.Fatalf("position %v dropped or trading not halted (%q)", tr.pos, tr.risk.Halted())
+	}
+}
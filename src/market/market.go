@@ -0,0 +1,13 @@
+// Package market holds the exchange data both the connectors fetching it and
+// the strategies simulating trades on it need.
+package market
+
+import "time"
+
+// FundingRate is the fraction of its notional a perpetual futures position
+// pays at a funding time, longs to shorts when positive, shorts to longs when
+// negative
+type FundingRate struct {
+	Time time.Time
+	Rate float64
+}
@@ -0,0 +1,357 @@
+package optimizers
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// settings of the Bayesian optimisation
+const (
+	// points proposed, and evaluated concurrently, per iteration
+	bayesBatch = 4
+	// random candidates the acquisition is maximised over, plus candidates
+	// around the best points observed
+	bayesCandidates      = 1000
+	bayesLocalCandidates = 200
+	bayesLocalSpread     = 0.05
+	// minimum improvement expected improvement looks for, in standard deviations
+	bayesXi = 0.01
+)
+
+// hyper-parameters of the GP tried on each fit, the one with the best marginal
+// likelihood is kept
+var (
+	lengthScales = []float64{0.1, 0.2, 0.35, 0.5, 0.8, 1.2}
+	noises       = []float64{1e-4, 1e-2, 1e-1}
+)
+
+// Bayes is Bayesian optimisation, fitting a Gaussian process to the individuals
+// evaluated so far and evaluating next the points with the highest expected
+// improvement over the best. It spends far fewer evaluations than the others,
+// population random individuals to start with then 4 per generation.
+type Bayes struct{}
+
+func (Bayes) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("bayes: %w", err)
+	}
+	space := problem.Space()
+	r := newRand(cfg)
+
+	var xs [][]float64
+	var ys []float64
+	observe := func(scores []genetics.Score) {
+		for _, s := range scores {
+			xs = append(xs, space.Normalize(s.Individual))
+			ys = append(ys, s.Value)
+		}
+	}
+
+	population := make([][]float64, cfg.PopulationSize)
+	for i := range population {
+		population[i] = space.Random(r)
+	}
+	scores := genetics.Evaluate(problem, population)
+	best := keepBest(nil, 0, scores)
+	observe(scores)
+
+	for gen := 1; gen <= cfg.Generations; gen++ {
+		// the GP works on standardised values, of which unfit ones would
+		// squash the others together
+		w := winsorize(ys)
+		mean, std := meanStd(w)
+		z := make([]float64, len(w))
+		for i, y := range w {
+			z[i] = (y - mean) / std
+		}
+
+		g, err := fitGP(xs, z)
+		if err != nil {
+			return nil, fmt.Errorf("bayes: %w", err)
+		}
+		target := slices.Max(z)
+
+		// kriging believer: each proposal is assumed to score what the GP
+		// predicts, so the next one of the batch goes elsewhere
+		batch := make([][]float64, 0, bayesBatch)
+		for range bayesBatch {
+			u := g.maximiseEI(r, space, target)
+			batch = append(batch, space.Denormalize(u))
+
+			m, _ := g.predict(u)
+			g, err = g.with(u, m)
+			if err != nil {
+				return nil, fmt.Errorf("bayes: %w", err)
+			}
+		}
+
+		scores := genetics.Evaluate(problem, batch)
+		best = keepBest(best, gen, scores)
+		observe(scores)
+	}
+
+	return best, nil
+}
+
+// winsorize returns the scores with the unfit ones, offset by how close they
+// came to fit, moved to within the spread of the others below the worst of
+// them, still ranked by their offset
+func winsorize(ys []float64) []float64 {
+	worst, bestFit := math.Inf(1), math.Inf(-1)
+	for _, y := range ys {
+		if y > genetics.Unfit/2 {
+			worst = min(worst, y)
+			bestFit = max(bestFit, y)
+		}
+	}
+	if math.IsInf(worst, 1) {
+		// no fit score to move them next to, their offsets rank them
+		worst, bestFit = 0, 0
+	}
+	margin := bestFit - worst
+	if margin == 0 {
+		margin = 1
+	}
+
+	w := make([]float64, len(ys))
+	for i, y := range ys {
+		w[i] = y
+		if y <= genetics.Unfit/2 {
+			w[i] = worst - margin/(1+max(y-genetics.Unfit, 0))
+		}
+	}
+	return w
+}
+
+func meanStd(ys []float64) (float64, float64) {
+	var mean, variance float64
+	for _, y := range ys {
+		mean += y
+	}
+	mean /= float64(len(ys))
+	for _, y := range ys {
+		variance += (y - mean) * (y - mean)
+	}
+	std := math.Sqrt(variance / float64(len(ys)))
+	if std == 0 {
+		std = 1
+	}
+	return mean, std
+}
+
+// gp is a Gaussian process with a Matérn 5/2 kernel of unit variance, fitted
+// to points of the unit cube
+type gp struct {
+	xs          [][]float64
+	ys          []float64
+	lengthScale float64
+	noise       float64
+	// Cholesky factor of the kernel matrix and its inverse times ys
+	chol  [][]float64
+	alpha []float64
+}
+
+// fitGP fits a GP to the points, picking the hyper-parameters with the best
+// marginal likelihood
+func fitGP(xs [][]float64, ys []float64) (*gp, error) {
+	var best *gp
+	bestLik := math.Inf(-1)
+
+	for _, l := range lengthScales {
+		for _, n := range noises {
+			g := &gp{xs: xs, ys: ys, lengthScale: l, noise: n}
+			if g.factor() != nil {
+				continue
+			}
+			if lik := g.logLikelihood(); lik > bestLik {
+				best, bestLik = g, lik
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("fitGP: kernel matrix of %d points is not positive definite", len(xs))
+	}
+	return best, nil
+}
+
+// with returns the GP with one more observation, keeping its hyper-parameters
+func (g *gp) with(x []float64, y float64) (*gp, error) {
+	next := &gp{
+		xs:          append(slices.Clone(g.xs), x),
+		ys:          append(slices.Clone(g.ys), y),
+		lengthScale: g.lengthScale,
+		noise:       g.noise,
+	}
+	err := next.factor()
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (g *gp) kernel(a, b []float64) float64 {
+	var d float64
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	r := math.Sqrt(5*d) / g.lengthScale
+	return (1 + r + r*r/3) * math.Exp(-r)
+}
+
+// factor computes the Cholesky factor of the kernel matrix and alpha
+func (g *gp) factor() error {
+	n := len(g.xs)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			sum := g.kernel(g.xs[i], g.xs[j])
+			if i == j {
+				sum += g.noise
+			}
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+
+			if i == j {
+				if sum <= 0 {
+					return fmt.Errorf("factor: kernel matrix is not positive definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	g.chol = l
+	g.alpha = backward(l, forward(l, g.ys))
+	return nil
+}
+
+// forward solves L x = b
+func forward(l [][]float64, b []float64) []float64 {
+	x := make([]float64, len(b))
+	for i := range x {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x
+}
+
+// backward solves L^T x = b
+func backward(l [][]float64, b []float64) []float64 {
+	x := make([]float64, len(b))
+	for i := len(x) - 1; i >= 0; i-- {
+		sum := b[i]
+		for k := i + 1; k < len(x); k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x
+}
+
+func (g *gp) logLikelihood() float64 {
+	lik := -0.5 * float64(len(g.ys)) * math.Log(2*math.Pi)
+	for i, y := range g.ys {
+		lik -= 0.5*y*g.alpha[i] + math.Log(g.chol[i][i])
+	}
+	return lik
+}
+
+// predict returns the mean and standard deviation of the GP at x
+func (g *gp) predict(x []float64) (float64, float64) {
+	k := make([]float64, len(g.xs))
+	var mean float64
+	for i, xi := range g.xs {
+		k[i] = g.kernel(x, xi)
+		mean += k[i] * g.alpha[i]
+	}
+
+	v := forward(g.chol, k)
+	variance := 1.0
+	for _, vi := range v {
+		variance -= vi * vi
+	}
+	return mean, math.Sqrt(max(variance, 1e-12))
+}
+
+// expectedImprovement of a point over the target, given the GP's prediction
+func expectedImprovement(mean, std, target float64) float64 {
+	d := mean - target - bayesXi
+	z := d / std
+	cdf := 0.5 * math.Erfc(-z/math.Sqrt2)
+	pdf := math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+	return d*cdf + std*pdf
+}
+
+// maximiseEI returns the candidate with the highest expected improvement,
+// among random points and points around the best ones observed
+func (g *gp) maximiseEI(r *rand.Rand, space params.Space, target float64) []float64 {
+	candidates := make([][]float64, 0, bayesCandidates+bayesLocalCandidates)
+	for range bayesCandidates {
+		candidates = append(candidates, space.Normalize(space.Random(r)))
+	}
+
+	order := make([]int, len(g.ys))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case g.ys[a] > g.ys[b]:
+			return -1
+		case g.ys[a] < g.ys[b]:
+			return 1
+		}
+		return 0
+	})
+	top := order[:min(10, len(order))]
+	for i := range bayesLocalCandidates {
+		x := g.xs[top[i%len(top)]]
+		u := make([]float64, len(x))
+		for d := range u {
+			u[d] = min(max(x[d]+r.NormFloat64()*bayesLocalSpread, 0), 1)
+		}
+		// snapped to the space so that integer and discrete genes are real values
+		candidates = append(candidates, space.Normalize(space.Denormalize(u)))
+	}
+
+	// candidates are scored concurrently, each on its own index so the pick
+	// doesn't depend on scheduling
+	ei := make([]float64, len(candidates))
+	workers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < len(candidates); i += workers {
+				m, s := g.predict(candidates[i])
+				ei[i] = expectedImprovement(m, s, target)
+			}
+		}()
+	}
+	wg.Wait()
+
+	best := 0
+	for i := range ei {
+		if ei[i] > ei[best] {
+			best = i
+		}
+	}
+	return candidates[best]
+}
@@ -0,0 +1,220 @@
+package optimizers
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+)
+
+// CMAES is the covariance matrix adaptation evolution strategy, sampling each
+// generation from a normal distribution over the unit cube the space is
+// normalised to, and adapting its mean, step size and covariance towards the
+// best samples. The population size is lambda.
+type CMAES struct{}
+
+func (CMAES) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("cmaes: %w", err)
+	}
+	space := problem.Space()
+	r := newRand(cfg)
+	n := len(space)
+	nf := float64(n)
+
+	// selection and adaptation settings, from Hansen's tutorial
+	lambda := max(cfg.PopulationSize, 4)
+	mu := lambda / 2
+	weights := make([]float64, mu)
+	var sum, sumSq float64
+	for i := range weights {
+		weights[i] = math.Log(float64(mu)+0.5) - math.Log(float64(i+1))
+		sum += weights[i]
+	}
+	for i := range weights {
+		weights[i] /= sum
+		sumSq += weights[i] * weights[i]
+	}
+	muEff := 1 / sumSq
+
+	cs := (muEff + 2) / (nf + muEff + 5)
+	ds := 1 + 2*max(0, math.Sqrt((muEff-1)/(nf+1))-1) + cs
+	cc := (4 + muEff/nf) / (nf + 4 + 2*muEff/nf)
+	c1 := 2 / ((nf+1.3)*(nf+1.3) + muEff)
+	cmu := min(1-c1, 2*(muEff-2+1/muEff)/((nf+2)*(nf+2)+muEff))
+	chiN := math.Sqrt(nf) * (1 - 1/(4*nf) + 1/(21*nf*nf))
+
+	mean := space.Normalize(space.Random(r))
+	sigma := 0.3
+	ps := make([]float64, n)
+	pc := make([]float64, n)
+	c := identity(n)
+
+	var best *genetics.Score
+	for gen := 0; gen < cfg.Generations; gen++ {
+		// C = B diag(D^2) B^T
+		b, d := eigen(c)
+		for i := range d {
+			d[i] = math.Sqrt(max(d[i], 1e-20))
+		}
+
+		ys := make([][]float64, lambda)
+		population := make([][]float64, lambda)
+		for k := range ys {
+			z := make([]float64, n)
+			for i := range z {
+				z[i] = r.NormFloat64() * d[i]
+			}
+			x := make([]float64, n)
+			for i := range x {
+				x[i] = mean[i]
+				for j := range z {
+					x[i] += sigma * b[i][j] * z[j]
+				}
+				x[i] = min(max(x[i], 0), 1)
+			}
+			// the step actually taken, once clipped to the cube
+			ys[k] = make([]float64, n)
+			for i := range x {
+				ys[k][i] = (x[i] - mean[i]) / sigma
+			}
+			population[k] = space.Denormalize(x)
+		}
+
+		scores := genetics.Evaluate(problem, population)
+		best = keepBest(best, gen, scores)
+
+		order := make([]int, lambda)
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(scores[b].Value, scores[a].Value)
+		})
+
+		yw := make([]float64, n)
+		for i, k := range order[:mu] {
+			for j := range yw {
+				yw[j] += weights[i] * ys[k][j]
+			}
+		}
+		for j := range mean {
+			mean[j] += sigma * yw[j]
+		}
+
+		// C^-1/2 yw = B diag(1/D) B^T yw
+		bty := make([]float64, n)
+		for i := range bty {
+			for j := range yw {
+				bty[i] += b[j][i] * yw[j]
+			}
+			bty[i] /= d[i]
+		}
+		var psNorm float64
+		for i := range ps {
+			var v float64
+			for j := range bty {
+				v += b[i][j] * bty[j]
+			}
+			ps[i] = (1-cs)*ps[i] + math.Sqrt(cs*(2-cs)*muEff)*v
+			psNorm += ps[i] * ps[i]
+		}
+		psNorm = math.Sqrt(psNorm)
+
+		hs := 0.0
+		if psNorm/math.Sqrt(1-math.Pow(1-cs, 2*float64(gen+1))) < (1.4+2/(nf+1))*chiN {
+			hs = 1
+		}
+		for i := range pc {
+			pc[i] = (1-cc)*pc[i] + hs*math.Sqrt(cc*(2-cc)*muEff)*yw[i]
+		}
+
+		for i := range c {
+			for j := range c[i] {
+				rankMu := 0.0
+				for w, k := range order[:mu] {
+					rankMu += weights[w] * ys[k][i] * ys[k][j]
+				}
+				c[i][j] = (1-c1-cmu)*c[i][j] +
+					c1*(pc[i]*pc[j]+(1-hs)*cc*(2-cc)*c[i][j]) +
+					cmu*rankMu
+			}
+		}
+
+		sigma *= math.Exp((cs / ds) * (psNorm/chiN - 1))
+		// a step beyond the whole cube is meaningless
+		sigma = min(sigma, 1)
+	}
+
+	return best, nil
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// eigen decomposes a symmetric matrix with the Jacobi method, returning its
+// eigenvectors as the columns of a matrix and its eigenvalues
+func eigen(m [][]float64) ([][]float64, []float64) {
+	n := len(m)
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = slices.Clone(m[i])
+	}
+	v := identity(n)
+
+	for sweep := 0; sweep < 50; sweep++ {
+		var off float64
+		for i := range a {
+			for j := i + 1; j < n; j++ {
+				off += a[i][j] * a[i][j]
+			}
+		}
+		if off < 1e-22 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(a[p][q]) < 1e-30 {
+					continue
+				}
+				// rotation zeroing a[p][q]
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				cos := 1 / math.Sqrt(t*t+1)
+				sin := t * cos
+
+				for k := 0; k < n; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = cos*akp - sin*akq
+					a[k][q] = sin*akp + cos*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = cos*apk - sin*aqk
+					a[q][k] = sin*apk + cos*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = cos*vkp - sin*vkq
+					v[k][q] = sin*vkp + cos*vkq
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = a[i][i]
+	}
+	return v, values
+}
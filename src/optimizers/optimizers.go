@@ -0,0 +1,70 @@
+// Package optimizers searches the parameter space of a genetics.Problem with
+// other methods than the GA, to have baselines to compare it against. Every
+// optimiser but Bayes evaluates at most population x generations individuals,
+// so they compare on the same budget.
+package optimizers
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+)
+
+// Optimizer searches for the individual of a problem with the best score
+type Optimizer interface {
+	Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error)
+}
+
+// New returns the optimiser with the given name
+func New(name string) (Optimizer, error) {
+	switch name {
+	case "", "ga":
+		return GA{}, nil
+	case "cmaes":
+		return CMAES{}, nil
+	case "pso":
+		return PSO{}, nil
+	case "random":
+		return RandomSearch{}, nil
+	case "grid":
+		return GridSearch{}, nil
+	case "bayes":
+		return Bayes{}, nil
+	default:
+		return nil, fmt.Errorf("unknown optimizer %q, expected ga, cmaes, pso, random, grid or bayes", name)
+	}
+}
+
+// GA is the genetic algorithm of the genetics package
+type GA struct {
+	genetics.Options
+}
+
+func (ga GA) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	return genetics.RunGeneticWith(problem, cfg, ga.Options)
+}
+
+func newRand(cfg genetics.Config) *rand.Rand {
+	return rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+}
+
+// keepBest returns the best of the current best and the scores, logging the
+// batch like the GA logs its generations
+func keepBest(best *genetics.Score, batch int, scores []genetics.Score) *genetics.Score {
+	batchBest := 0
+	for i, s := range scores {
+		if s.Value > scores[batchBest].Value {
+			batchBest = i
+		}
+	}
+
+	if best == nil || scores[batchBest].Value > best.Value {
+		s := scores[batchBest]
+		best = &s
+	}
+	log.Printf("Generation %d: Fitness: %.2f, best so far: %.2f, Trades: %d\n", batch, scores[batchBest].Value, best.Value, best.TotalTrades)
+
+	return best
+}
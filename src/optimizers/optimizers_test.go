@@ -0,0 +1,136 @@
+package optimizers
+
+import (
+	"math"
+	"testing"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// sphere scores the negated squared distance to a known optimum
+type sphere struct{}
+
+var optimum = []float64{1.5, 7, 2}
+
+func (sphere) Space() params.Space {
+	return params.Space{
+		{Name: "a", Kind: params.Continuous, Min: -5, Max: 5, Step: 0.5},
+		{Name: "b", Kind: params.Integer, Min: 0, Max: 20},
+		{Name: "c", Kind: params.Discrete, Choices: []float64{0.5, 1, 2, 4}},
+	}
+}
+
+func (sphere) Evaluate(individual []float64) genetics.Score {
+	var d float64
+	for i, v := range individual {
+		d += (v - optimum[i]) * (v - optimum[i])
+	}
+	return genetics.Score{Value: -d, Individual: individual}
+}
+
+func TestOptimizersFindOptimum(t *testing.T) {
+	cfg := genetics.DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Immigrants = 4
+	cfg.Generations = 30
+	cfg.Seed = 7
+
+	for _, name := range []string{"ga", "cmaes", "pso", "random", "grid", "bayes"} {
+		o, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		best, err := o.Optimize(sphere{}, cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// the grid is only as fine as the budget allows, 8 levels here
+		if best.Value < -2 {
+			t.Errorf("%s: best %v scores %v, too far from %v", name, best.Individual, best.Value, optimum)
+		}
+
+		again, _ := o.Optimize(sphere{}, cfg)
+		if again.Value != best.Value {
+			t.Errorf("%s: same seed scored %v then %v", name, best.Value, again.Value)
+		}
+	}
+}
+
+// sparse is the sphere with the individuals of negative a penalised like
+// backtests without enough trades, the closer to 0 the higher
+type sparse struct{ sphere }
+
+func (p sparse) Evaluate(individual []float64) genetics.Score {
+	if individual[0] < 0 {
+		return genetics.Score{Value: genetics.Unfit - individual[0], Individual: individual}
+	}
+	return p.sphere.Evaluate(individual)
+}
+
+func TestBayesWithUnfitIndividuals(t *testing.T) {
+	cfg := genetics.DefaultConfig()
+	cfg.PopulationSize = 20
+	cfg.Immigrants = 4
+	cfg.Generations = 10
+	cfg.Seed = 3
+
+	// with the unfit scores as they are the GP sees the others as equal and
+	// the search is no better than random, 3.5 from the optimum
+	best, err := Bayes{}.Optimize(sparse{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Value < -1 {
+		t.Errorf("best %v scores %v, too far from %v", best.Individual, best.Value, optimum)
+	}
+}
+
+func TestWinsorize(t *testing.T) {
+	ys := []float64{-3, genetics.Unfit + 2, 5, genetics.Unfit}
+	w := winsorize(ys)
+
+	if w[0] != -3 || w[2] != 5 {
+		t.Errorf("fit scores changed: %v", w)
+	}
+	if !(w[3] < w[1] && w[1] < -3) {
+		t.Errorf("unfit scores %v should rank below the fit ones, the closer to fit the higher", w)
+	}
+	if w[3] < -3-2*8 {
+		t.Errorf("unfit score %v too far below the worst fit one", w[3])
+	}
+}
+
+func TestLatinHypercube(t *testing.T) {
+	points := latinHypercube(newRand(genetics.Config{Seed: 1}), 50, 20)
+
+	// every parameter has a value in each of the 50 strata of its range
+	for d := range 20 {
+		seen := make(map[int]bool)
+		for _, u := range points {
+			seen[int(u[d]*50)] = true
+		}
+		if len(seen) != 50 {
+			t.Fatalf("parameter %d covers %d strata out of 50", d, len(seen))
+		}
+	}
+}
+
+func TestEigen(t *testing.T) {
+	m := [][]float64{{4, 1, 0}, {1, 3, 1}, {0, 1, 2}}
+	v, d := eigen(m)
+
+	// m v = d v for every eigenvector
+	for k := range d {
+		for i := range m {
+			var mv float64
+			for j := range m {
+				mv += m[i][j] * v[j][k]
+			}
+			if math.Abs(mv-d[k]*v[i][k]) > 1e-9 {
+				t.Fatalf("column %d is not an eigenvector of %v: %v", k, d[k], v)
+			}
+		}
+	}
+}
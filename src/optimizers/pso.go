@@ -0,0 +1,85 @@
+package optimizers
+
+import (
+	"fmt"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+)
+
+// settings of the swarm, the usual ones from the literature
+const (
+	inertia     = 0.72
+	cognitive   = 1.49
+	social      = 1.49
+	maxVelocity = 0.2
+)
+
+// PSO is a particle swarm, a population of particles moving through the unit
+// cube the space is normalised to, each pulled towards the best point it has
+// seen and the best point the swarm has seen
+type PSO struct{}
+
+func (PSO) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("pso: %w", err)
+	}
+	space := problem.Space()
+	r := newRand(cfg)
+
+	positions := make([][]float64, cfg.PopulationSize)
+	velocities := make([][]float64, cfg.PopulationSize)
+	for i := range positions {
+		positions[i] = space.Normalize(space.Random(r))
+		velocities[i] = make([]float64, len(space))
+		for d := range velocities[i] {
+			velocities[i][d] = (r.Float64()*2 - 1) * maxVelocity / 2
+		}
+	}
+
+	personal := make([]genetics.Score, cfg.PopulationSize)
+	personalPos := make([][]float64, cfg.PopulationSize)
+	var best *genetics.Score
+	var bestPos []float64
+
+	for gen := 0; gen < cfg.Generations; gen++ {
+		population := make([][]float64, len(positions))
+		for i, p := range positions {
+			population[i] = space.Denormalize(p)
+		}
+		scores := genetics.Evaluate(problem, population)
+
+		for i, s := range scores {
+			if gen == 0 || s.Value > personal[i].Value {
+				personal[i] = s
+				personalPos[i] = slices.Clone(positions[i])
+			}
+		}
+		prev := best
+		best = keepBest(best, gen, scores)
+		if best != prev {
+			i := slices.IndexFunc(scores, func(s genetics.Score) bool { return s.Value == best.Value })
+			bestPos = slices.Clone(positions[i])
+		}
+
+		for i, p := range positions {
+			v := velocities[i]
+			for d := range p {
+				v[d] = inertia*v[d] +
+					cognitive*r.Float64()*(personalPos[i][d]-p[d]) +
+					social*r.Float64()*(bestPos[d]-p[d])
+				v[d] = min(max(v[d], -maxVelocity), maxVelocity)
+
+				p[d] += v[d]
+				// particles stop at the walls of the cube
+				if p[d] < 0 || p[d] > 1 {
+					p[d] = min(max(p[d], 0), 1)
+					v[d] = 0
+				}
+			}
+		}
+	}
+
+	return best, nil
+}
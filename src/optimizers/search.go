@@ -0,0 +1,102 @@
+package optimizers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+)
+
+// RandomSearch evaluates random individuals, a generation at a time
+type RandomSearch struct{}
+
+func (RandomSearch) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("randomSearch: %w", err)
+	}
+	space := problem.Space()
+	r := newRand(cfg)
+
+	var best *genetics.Score
+	for gen := 0; gen < cfg.Generations; gen++ {
+		population := make([][]float64, cfg.PopulationSize)
+		for i := range population {
+			population[i] = space.Random(r)
+		}
+		best = keepBest(best, gen, genetics.Evaluate(problem, population))
+	}
+
+	return best, nil
+}
+
+// GridSearch evaluates the points of a regular grid over the space, with as
+// many levels per parameter as the budget allows. With fewer than three levels
+// the grid would only try the corners of the space, so the budget goes to a
+// Latin hypercube sample instead, covering every parameter over its range.
+type GridSearch struct{}
+
+func (GridSearch) Optimize(problem genetics.Problem, cfg genetics.Config) (*genetics.Score, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("gridSearch: %w", err)
+	}
+	space := problem.Space()
+	r := newRand(cfg)
+	budget := cfg.PopulationSize * cfg.Generations
+
+	levels := int(math.Pow(float64(budget), 1/float64(len(space))))
+	// the root can round up
+	if math.Pow(float64(levels), float64(len(space))) > float64(budget) {
+		levels--
+	}
+
+	// normalised points to visit
+	var points [][]float64
+	if levels >= 3 {
+		size := int(math.Pow(float64(levels), float64(len(space))))
+		for i := range size {
+			// the index of the point, in base levels, gives the level of each parameter
+			u := make([]float64, len(space))
+			for d := range u {
+				u[d] = float64(i%levels) / float64(levels-1)
+				i /= levels
+			}
+			points = append(points, u)
+		}
+	} else {
+		log.Printf("A grid of 3 levels over %d parameters doesn't fit in %d points, sampling a Latin hypercube", len(space), budget)
+		points = latinHypercube(r, budget, len(space))
+	}
+
+	var best *genetics.Score
+	for gen := 0; len(points) > 0; gen++ {
+		n := min(cfg.PopulationSize, len(points))
+		population := make([][]float64, n)
+		for k, u := range points[:n] {
+			population[k] = space.Denormalize(u)
+		}
+		points = points[n:]
+
+		best = keepBest(best, gen, genetics.Evaluate(problem, population))
+	}
+
+	return best, nil
+}
+
+// latinHypercube returns n points of the unit cube of the dimensions, each
+// parameter taking a value in every one of n equal strata of its range
+func latinHypercube(r *rand.Rand, n, dimensions int) [][]float64 {
+	points := make([][]float64, n)
+	for k := range points {
+		points[k] = make([]float64, dimensions)
+	}
+	for d := range dimensions {
+		for k, stratum := range r.Perm(n) {
+			points[k][d] = (float64(stratum) + r.Float64()) / float64(n)
+		}
+	}
+	return points
+}
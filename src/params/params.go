@@ -0,0 +1,146 @@
+// Package params describes the parameter space of a strategy, so optimisers
+// can search it without knowing what each parameter means.
+package params
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+type Kind int
+
+const (
+	// Continuous parameters take any value in [Min, Max], random ones are drawn on a Step grid
+	Continuous Kind = iota
+	// Integer parameters take whole values in [Min, Max]
+	Integer
+	// Discrete parameters take one of their Choices, in ascending order
+	Discrete
+)
+
+type Param struct {
+	Name    string
+	Kind    Kind
+	Min     float64
+	Max     float64
+	Step    float64
+	Choices []float64
+}
+
+// Space is an ordered list of parameters, a point in it is a []float64 holding
+// the value of each parameter at the same index.
+type Space []Param
+
+// Random draws a point, each parameter on its own grid
+func (s Space) Random(r *rand.Rand) []float64 {
+	v := make([]float64, len(s))
+	for i, p := range s {
+		switch p.Kind {
+		case Discrete:
+			v[i] = p.Choices[r.IntN(len(p.Choices))]
+		default:
+			steps := int(math.Round((p.Max-p.Min)/p.step())) + 1
+			v[i] = p.Min + float64(r.IntN(steps))*p.step()
+		}
+	}
+	return v
+}
+
+// Clamp brings a point back into the space in place, rounding integers and snapping
+// discrete parameters to their nearest choice
+func (s Space) Clamp(v []float64) []float64 {
+	for i, p := range s {
+		v[i] = p.Clamp(v[i])
+	}
+	return v
+}
+
+func (p Param) Clamp(v float64) float64 {
+	switch p.Kind {
+	case Integer:
+		return math.Min(math.Max(math.Round(v), p.Min), p.Max)
+	case Discrete:
+		best := p.Choices[0]
+		for _, c := range p.Choices {
+			if math.Abs(c-v) < math.Abs(best-v) {
+				best = c
+			}
+		}
+		return best
+	default:
+		return math.Min(math.Max(v, p.Min), p.Max)
+	}
+}
+
+// Bounds returns the lowest and highest values the parameter takes
+func (p Param) Bounds() (float64, float64) {
+	if p.Kind == Discrete {
+		return p.Choices[0], p.Choices[len(p.Choices)-1]
+	}
+	return p.Min, p.Max
+}
+
+func (p Param) step() float64 {
+	if p.Step > 0 {
+		return p.Step
+	}
+	if p.Kind == Integer {
+		return 1
+	}
+	return (p.Max - p.Min) / 10
+}
+
+// Normalize maps a point to the unit cube, each parameter scaled from its
+// bounds to [0, 1]
+func (s Space) Normalize(v []float64) []float64 {
+	u := make([]float64, len(s))
+	for i, p := range s {
+		lo, hi := p.Bounds()
+		if hi > lo {
+			u[i] = (v[i] - lo) / (hi - lo)
+		}
+	}
+	return u
+}
+
+// Denormalize maps a point of the unit cube back into the space, clamped
+func (s Space) Denormalize(u []float64) []float64 {
+	v := make([]float64, len(s))
+	for i, p := range s {
+		lo, hi := p.Bounds()
+		v[i] = p.Clamp(lo + u[i]*(hi-lo))
+	}
+	return v
+}
+
+// ToMap names the values of a point
+func (s Space) ToMap(v []float64) map[string]float64 {
+	m := make(map[string]float64, len(s))
+	for i, p := range s {
+		m[p.Name] = v[i]
+	}
+	return m
+}
+
+// FromMap builds a point from named values, parameters missing from the map
+// are set to their lower bound
+func (s Space) FromMap(m map[string]float64) []float64 {
+	v := make([]float64, len(s))
+	for i, p := range s {
+		value, ok := m[p.Name]
+		if !ok {
+			value, _ = p.Bounds()
+		}
+		v[i] = p.Clamp(value)
+	}
+	return v
+}
+
+// ID identifies the space, for caches of results depending on it
+func (s Space) ID() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", s)))
+	return hex.EncodeToString(sum[:])
+}
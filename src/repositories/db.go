@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/cinar/indicator/v2/asset"
@@ -69,6 +70,39 @@ func GetSnapshots(db *sql.DB, a string, limit int) ([]*asset.Snapshot, error) {
 	return snapshots, nil
 }
 
+// GetSnapshotsBetween returns the snapshots from from to before to, oldest first
+func GetSnapshotsBetween(db *sql.DB, a string, from, to time.Time) ([]*asset.Snapshot, error) {
+	query := `SELECT date, open, high, low, close, volume FROM snapshots WHERE asset = $1 AND date >= $2 AND date < $3 ORDER BY date`
+	layout := "2006-01-02T15:04:05Z"
+	var dateStr string
+
+	rows, err := db.Query(query, a, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("getSnapshotsBetween: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*asset.Snapshot
+	for rows.Next() {
+		var snapshot asset.Snapshot
+		err := rows.Scan(&dateStr, &snapshot.Open, &snapshot.High, &snapshot.Low, &snapshot.Close, &snapshot.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("getSnapshotsBetween: %w", err)
+		}
+
+		localLocation := time.Now().Location()
+		parsed, err := time.ParseInLocation(layout, dateStr, localLocation)
+		if err != nil {
+			return nil, fmt.Errorf("getSnapshotsBetween, parse date: %w", err)
+		}
+
+		snapshot.Date = parsed
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	return snapshots, nil
+}
+
 func InsertSnapshots(db *sql.DB, a string, ss chan *asset.Snapshot) error {
 	query := `INSERT INTO snapshots (asset, date, open, high, low, close, volume) VALUES ($1, $2, $3, $4, $5, $6, $7)`
 	for snapshot := range ss {
@@ -101,6 +135,9 @@ func NewDBRepository(a string, limit int) (asset.Repository, error) {
 		return nil, fmt.Errorf("error fetching snapshots: %w", err)
 	}
 
+	// snapshots come newest first, strategies need them in chronological order
+	slices.Reverse(ss)
+
 	sschan := helper.SliceToChan(ss)
 	err = repo.Append(a, sschan)
 	if err != nil {
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// sources of journal entries, so live results can be told apart from simulated ones
+const (
+	SourceLive     = "live"
+	SourceBacktest = "backtest"
+)
+
+type JournalOrder struct {
+	ExchangeID     int64
+	Date           time.Time
+	Side           string
+	Quantity       float64
+	RequestedPrice float64
+	FillPrice      float64
+	Fees           float64
+	Status         string
+}
+
+// InsertOrder journals an order, genomeID 0 means it was not placed by a stored genome
+func InsertOrder(db *sql.DB, a, source string, genomeID int, o JournalOrder) error {
+	query := `INSERT INTO orders (asset, source, genome_id, exchange_id, date, side, quantity, requested_price, fill_price, fees, status)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9, $10, $11)`
+	_, err := db.Exec(query, a, source, genomeID, o.ExchangeID, o.Date, o.Side, o.Quantity, o.RequestedPrice, o.FillPrice, o.Fees, o.Status)
+	if err != nil {
+		return fmt.Errorf("insertOrder: %w", err)
+	}
+	return nil
+}
+
+// InsertTrade journals a closed round-trip trade, genomeID 0 means it was not placed by a stored genome
+func InsertTrade(db *sql.DB, a, source string, genomeID int, t strategies.Trade) error {
+	query := `INSERT INTO trades (asset, source, genome_id, side, quantity, entry_time, entry_price, exit_time, exit_price, pnl, fees, funding, mae, mfe, exit_reason)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := db.Exec(query, a, source, genomeID, t.Type.String(), t.Quantity, t.EntryTime, t.EntryPrice, t.ExitTime, t.ExitPrice, t.PnL, t.Fees, t.Funding, t.MAE, t.MFE, string(t.ExitReason))
+	if err != nil {
+		return fmt.Errorf("insertTrade: %w", err)
+	}
+	return nil
+}
+
+// InsertSimulatedTrade journals a backtested trade along with the two orders
+// that would have opened and closed it.
+func InsertSimulatedTrade(db *sql.DB, a string, genomeID int, t strategies.Trade) error {
+	entrySide, exitSide := "BUY", "SELL"
+	if t.Type == strategies.SHORT {
+		entrySide, exitSide = "SELL", "BUY"
+	}
+
+	orders := []JournalOrder{
+		{Date: t.EntryTime, Side: entrySide, Quantity: t.Quantity, RequestedPrice: t.EntryPrice, FillPrice: t.EntryPrice, Status: "FILLED"},
+		{Date: t.ExitTime, Side: exitSide, Quantity: t.Quantity, RequestedPrice: t.ExitPrice, FillPrice: t.ExitPrice, Status: "FILLED"},
+	}
+	for _, o := range orders {
+		err := InsertOrder(db, a, SourceBacktest, genomeID, o)
+		if err != nil {
+			return err
+		}
+	}
+
+	return InsertTrade(db, a, SourceBacktest, genomeID, t)
+}
@@ -0,0 +1,57 @@
+package risk
+
+import (
+	"sync"
+)
+
+// Budget caps the notional held open across every asset traded by the process.
+type Budget struct {
+	mu    sync.Mutex
+	Limit float64
+	used  map[string]float64
+}
+
+func NewBudget(limit float64) *Budget {
+	return &Budget{
+		Limit: limit,
+		used:  map[string]float64{},
+	}
+}
+
+// Reserve books notional for an asset, returning false if it would push the
+// account over its limit. A zero limit means no cap.
+func (b *Budget) Reserve(asset string, notional float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Limit > 0 && b.total()+notional > b.Limit {
+		return false
+	}
+
+	b.used[asset] += notional
+	return true
+}
+
+// Release frees everything reserved by an asset once its position is closed.
+func (b *Budget) Release(asset string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.used, asset)
+}
+
+// Used returns the notional currently reserved across all assets.
+func (b *Budget) Used() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.total()
+}
+
+func (b *Budget) total() float64 {
+	total := 0.0
+	for _, n := range b.used {
+		total += n
+	}
+	return total
+}
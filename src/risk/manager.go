@@ -0,0 +1,239 @@
+package risk
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits a Manager enforces, zero values disable the matching check
+type Limits struct {
+	MaxDailyLoss         float64
+	MaxConsecutiveLosses int
+	MaxOpenNotional      float64
+	MaxOrdersPerHour     int
+	// trading halts for as long as this file exists
+	KillSwitchFile string
+}
+
+// Manager sits between the strategies and the exchange. Every order opening a
+// position must be allowed by it, and once a limit is breached it halts trading
+// on all assets until resumed.
+type Manager struct {
+	Limits Limits
+
+	mu                sync.Mutex
+	budget            *Budget
+	day               time.Time
+	dailyPnL          float64
+	consecutiveLosses int
+	orders            []time.Time
+	// reason of each active halt by cause, trading is halted while any is
+	halts map[cause]string
+}
+
+// cause of a halt, each lifted on its own terms
+type cause int
+
+const (
+	// a manual kill, lifted by Resume
+	manual cause = iota
+	// consecutive losses, lifted by Resume
+	losses
+	// the daily loss limit, lifted at midnight or by Resume
+	dailyLoss
+)
+
+type Status struct {
+	Halted            bool    `json:"halted"`
+	Reason            string  `json:"reason,omitempty"`
+	DailyPnL          float64 `json:"dailyPnl"`
+	ConsecutiveLosses int     `json:"consecutiveLosses"`
+	OpenNotional      float64 `json:"openNotional"`
+	OrdersLastHour    int     `json:"ordersLastHour"`
+}
+
+func NewManager(limits Limits) *Manager {
+	return &Manager{
+		Limits: limits,
+		budget: NewBudget(limits.MaxOpenNotional),
+		halts:  map[cause]string{},
+	}
+}
+
+// AllowOrder checks an order opening a position against every limit and, when
+// allowed, books its notional until Release is called for the asset.
+func (m *Manager) AllowOrder(asset string, notional float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if reason := m.haltedLocked(); reason != "" {
+		return fmt.Errorf("trading halted: %s", reason)
+	}
+
+	now := time.Now()
+	recent := m.orders[:0]
+	for _, o := range m.orders {
+		if now.Sub(o) < time.Hour {
+			recent = append(recent, o)
+		}
+	}
+	m.orders = recent
+
+	if m.Limits.MaxOrdersPerHour > 0 && len(m.orders) >= m.Limits.MaxOrdersPerHour {
+		return fmt.Errorf("max orders per hour reached (%d)", m.Limits.MaxOrdersPerHour)
+	}
+
+	if !m.budget.Reserve(asset, notional) {
+		return fmt.Errorf("max open notional reached (%.2f in use)", m.budget.Used())
+	}
+
+	m.orders = append(m.orders, now)
+	return nil
+}
+
+// Release frees the notional booked by an asset once its position is closed
+func (m *Manager) Release(asset string) {
+	m.budget.Release(asset)
+}
+
+// RecordTrade accounts for the PnL of a closed trade, halting trading if it
+// breaches the daily loss or consecutive losses limits.
+func (m *Manager) RecordTrade(pnl float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rollDay()
+	m.dailyPnL += pnl
+	if pnl < 0 {
+		m.consecutiveLosses++
+	} else {
+		m.consecutiveLosses = 0
+	}
+
+	if m.Limits.MaxDailyLoss > 0 && -m.dailyPnL >= m.Limits.MaxDailyLoss {
+		m.halt(dailyLoss, fmt.Sprintf("daily loss of %.2f breached the %.2f limit", -m.dailyPnL, m.Limits.MaxDailyLoss))
+	}
+
+	if m.Limits.MaxConsecutiveLosses > 0 && m.consecutiveLosses >= m.Limits.MaxConsecutiveLosses {
+		m.halt(losses, fmt.Sprintf("%d consecutive losses", m.consecutiveLosses))
+	}
+}
+
+// Halted returns why trading is halted, or an empty string if it is not.
+// Traders are expected to flatten their positions while halted.
+func (m *Manager) Halted() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.haltedLocked()
+}
+
+// Kill halts trading manually
+func (m *Manager) Kill(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.halt(manual, reason)
+}
+
+// Resume lifts every halt and resets the consecutive losses count. A kill
+// switch file still present keeps trading halted.
+func (m *Manager) Resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log.Printf("Risk: trading resumed")
+	clear(m.halts)
+	m.consecutiveLosses = 0
+}
+
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reason := m.haltedLocked()
+	return Status{
+		Halted:            reason != "",
+		Reason:            reason,
+		DailyPnL:          m.dailyPnL,
+		ConsecutiveLosses: m.consecutiveLosses,
+		OpenNotional:      m.budget.Used(),
+		OrdersLastHour:    len(m.orders),
+	}
+}
+
+// Handler exposes the kill switch: GET returns the status, POST /kill halts
+// trading and POST /resume lifts the halt. POST requests must send the token as
+// a bearer token, and are refused when it's empty.
+func (m *Manager) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/kill":
+				m.Kill("kill switch triggered over HTTP")
+			case "/resume":
+				m.Resume()
+			default:
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Status())
+	})
+}
+
+func (m *Manager) haltedLocked() string {
+	if m.Limits.KillSwitchFile != "" {
+		if _, err := os.Stat(m.Limits.KillSwitchFile); err == nil {
+			return fmt.Sprintf("kill switch file %s present", m.Limits.KillSwitchFile)
+		}
+	}
+
+	m.rollDay()
+	var reasons []string
+	for _, c := range []cause{manual, losses, dailyLoss} {
+		if reason, ok := m.halts[c]; ok {
+			reasons = append(reasons, reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// rollDay resets the daily PnL, and any halt caused by it, at midnight
+func (m *Manager) rollDay() {
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if day.Equal(m.day) {
+		return
+	}
+
+	if _, ok := m.halts[dailyLoss]; ok {
+		log.Printf("Risk: new day, lifting daily loss halt")
+		delete(m.halts, dailyLoss)
+	}
+	m.day = day
+	m.dailyPnL = 0
+}
+
+// halt halts trading for the cause, keeping the first reason while it lasts
+func (m *Manager) halt(c cause, reason string) {
+	if _, ok := m.halts[c]; !ok {
+		log.Printf("Risk: halting trading, %s", reason)
+		m.halts[c] = reason
+	}
+}
@@ -0,0 +1,157 @@
+package risk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDay makes the manager roll over to a new day on its next check
+func newDay(m *Manager) {
+	m.day = m.day.AddDate(0, 0, -1)
+}
+
+func TestDailyLossHaltLiftsAtMidnight(t *testing.T) {
+	m := NewManager(Limits{MaxDailyLoss: 100})
+
+	m.RecordTrade(-60)
+	if reason := m.Halted(); reason != "" {
+		t.Fatalf("halted under the limit: %s", reason)
+	}
+	m.RecordTrade(-50)
+	if reason := m.Halted(); !strings.Contains(reason, "daily loss") {
+		t.Fatalf("got halt %q, expected the daily loss", reason)
+	}
+
+	newDay(m)
+	if reason := m.Halted(); reason != "" {
+		t.Fatalf("still halted on a new day: %s", reason)
+	}
+	if m.Status().DailyPnL != 0 {
+		t.Fatalf("daily PnL %.2f on a new day", m.Status().DailyPnL)
+	}
+}
+
+func TestMidnightKeepsOtherHalts(t *testing.T) {
+	m := NewManager(Limits{MaxDailyLoss: 100, MaxConsecutiveLosses: 3})
+
+	m.RecordTrade(-150)
+	m.Kill("manual")
+	m.RecordTrade(-1)
+	m.RecordTrade(-1)
+	reason := m.Halted()
+	for _, want := range []string{"manual", "3 consecutive losses", "daily loss"} {
+		if !strings.Contains(reason, want) {
+			t.Fatalf("halt %q doesn't mention %q", reason, want)
+		}
+	}
+
+	// only the daily loss halt is lifted at midnight
+	newDay(m)
+	reason = m.Halted()
+	if strings.Contains(reason, "daily loss") || !strings.Contains(reason, "manual") || !strings.Contains(reason, "consecutive losses") {
+		t.Fatalf("got halt %q on a new day, expected the kill and the losses", reason)
+	}
+
+	m.Resume()
+	if reason := m.Halted(); reason != "" {
+		t.Fatalf("still halted after resuming: %s", reason)
+	}
+	if m.Status().ConsecutiveLosses != 0 {
+		t.Fatalf("%d consecutive losses after resuming", m.Status().ConsecutiveLosses)
+	}
+}
+
+func TestConsecutiveLossesResetOnWin(t *testing.T) {
+	m := NewManager(Limits{MaxConsecutiveLosses: 2})
+
+	m.RecordTrade(-1)
+	m.RecordTrade(1)
+	m.RecordTrade(-1)
+	if reason := m.Halted(); reason != "" {
+		t.Fatalf("halted after a win: %s", reason)
+	}
+	m.RecordTrade(-1)
+	if reason := m.Halted(); reason == "" {
+		t.Fatal("not halted after 2 losses in a row")
+	}
+}
+
+func TestAllowOrder(t *testing.T) {
+	m := NewManager(Limits{MaxOpenNotional: 1000, MaxOrdersPerHour: 2})
+
+	if err := m.AllowOrder("BTCUSDT", 600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllowOrder("ETHUSDT", 600); err == nil {
+		t.Fatal("allowed an order over the open notional")
+	}
+	m.Release("BTCUSDT")
+	if err := m.AllowOrder("ETHUSDT", 600); err != nil {
+		t.Fatal(err)
+	}
+	m.Release("ETHUSDT")
+	if err := m.AllowOrder("ETHUSDT", 100); err == nil {
+		t.Fatal("allowed a third order in the hour")
+	}
+
+	m.Kill("manual")
+	if err := m.AllowOrder("BTCUSDT", 1); err == nil {
+		t.Fatal("allowed an order while halted")
+	}
+}
+
+func TestKillSwitchFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kill")
+	m := NewManager(Limits{KillSwitchFile: file})
+
+	if reason := m.Halted(); reason != "" {
+		t.Fatalf("halted without the file: %s", reason)
+	}
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.Resume()
+	if reason := m.Halted(); !strings.Contains(reason, "kill switch file") {
+		t.Fatalf("got halt %q, expected the kill switch file", reason)
+	}
+}
+
+func TestHandlerNeedsToken(t *testing.T) {
+	post := func(h http.Handler, path, token string) int {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	m := NewManager(Limits{})
+	h := m.Handler("secret")
+	for _, token := range []string{"", "wrong"} {
+		if code := post(h, "/kill", token); code != http.StatusForbidden || m.Halted() != "" {
+			t.Fatalf("kill with token %q: status %d, halt %q", token, code, m.Halted())
+		}
+	}
+	if code := post(h, "/kill", "secret"); code != http.StatusOK || m.Halted() == "" {
+		t.Fatalf("kill with the token: status %d, not halted", code)
+	}
+	if code := post(m.Handler(""), "/resume", ""); code != http.StatusForbidden || m.Halted() == "" {
+		t.Fatalf("resume without a token configured: status %d, halt %q", code, m.Halted())
+	}
+	if code := post(h, "/resume", "secret"); code != http.StatusOK || m.Halted() != "" {
+		t.Fatalf("resume with the token: status %d, halt %q", code, m.Halted())
+	}
+
+	// the status needs no token
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: %d", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package sizing
+
+import (
+	"fmt"
+	"math"
+)
+
+// Context is what a sizer knows about the account and market when a position is opened
+type Context struct {
+	Price   float64
+	Balance float64
+	Atr     float64
+	// distance from entry to the stop loss, in price units
+	StopDistance float64
+	// PnL of the most recent closed trades, oldest first
+	RecentPnL []float64
+}
+
+// Sizer decides the quantity of a new position
+type Sizer interface {
+	Quantity(ctx Context) float64
+}
+
+// FixedNotional trades the same notional every time
+type FixedNotional struct {
+	Notional float64
+}
+
+func (f FixedNotional) Quantity(ctx Context) float64 {
+	return f.Notional / ctx.Price
+}
+
+// PercentOfBalance trades a percentage of the account balance
+type PercentOfBalance struct {
+	Percent float64
+}
+
+func (p PercentOfBalance) Quantity(ctx Context) float64 {
+	return ctx.Balance * p.Percent / 100 / ctx.Price
+}
+
+// RiskPerTrade sizes the position so that hitting the stop loss loses a
+// percentage of the balance, trading less when volatility is high. Without a
+// stop, AtrMultiple times the ATR is used as the distance at risk.
+type RiskPerTrade struct {
+	Percent     float64
+	AtrMultiple float64
+}
+
+func (r RiskPerTrade) Quantity(ctx Context) float64 {
+	distance := ctx.StopDistance
+	if distance <= 0 {
+		distance = r.AtrMultiple * ctx.Atr
+	}
+	if distance <= 0 {
+		return 0
+	}
+
+	return ctx.Balance * r.Percent / 100 / distance
+}
+
+// FractionalKelly bets a fraction of the Kelly criterion computed from the
+// recent trades, falling back to another sizer until there are enough of them.
+type FractionalKelly struct {
+	Fraction  float64
+	MinTrades int
+	Lookback  int
+	Fallback  Sizer
+}
+
+func (k FractionalKelly) Quantity(ctx Context) float64 {
+	pnl := ctx.RecentPnL
+	if len(pnl) > k.Lookback {
+		pnl = pnl[len(pnl)-k.Lookback:]
+	}
+
+	if len(pnl) < k.MinTrades {
+		return k.Fallback.Quantity(ctx)
+	}
+
+	var wins, winSum, lossSum float64
+	for _, p := range pnl {
+		if p > 0 {
+			wins++
+			winSum += p
+		} else {
+			lossSum -= p
+		}
+	}
+
+	losses := float64(len(pnl)) - wins
+	if wins == 0 {
+		return 0
+	}
+	if losses == 0 || lossSum == 0 {
+		// never lost, bet as if losses were as big as wins
+		lossSum, losses = winSum, wins
+	}
+
+	winRate := wins / float64(len(pnl))
+	payoff := (winSum / wins) / (lossSum / losses)
+	kelly := winRate - (1-winRate)/payoff
+	if kelly <= 0 {
+		return 0
+	}
+
+	return ctx.Balance * math.Min(kelly*k.Fraction, 1) / ctx.Price
+}
+
+// New builds a sizer by name, size is the notional for "fixed", the percentage
+// of the balance for "percent", the percentage risked per trade for "risk"
+// and the Kelly fraction for "kelly".
+func New(name string, size float64) (Sizer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("size must be positive, got %v", size)
+	}
+
+	switch name {
+	case "fixed":
+		return FixedNotional{Notional: size}, nil
+	case "percent":
+		return PercentOfBalance{Percent: size}, nil
+	case "risk":
+		return RiskPerTrade{Percent: size, AtrMultiple: 2}, nil
+	case "kelly":
+		return FractionalKelly{
+			Fraction:  size,
+			MinTrades: 20,
+			Lookback:  100,
+			Fallback:  PercentOfBalance{Percent: 5},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sizer %q, expected fixed, percent, risk or kelly", name)
+	}
+}
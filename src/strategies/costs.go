@@ -0,0 +1,101 @@
+package strategies
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/market"
+)
+
+// Costs are what simulated trades pay on top of the price move. Positions are
+// opened and closed with market orders, paying the taker fee and slippage on
+// both fills, unless LimitEntries.
+type Costs struct {
+	// fees in basis points of the notional of each fill
+	TakerBps float64 `json:"takerBps"`
+	MakerBps float64 `json:"makerBps"`
+	// LimitEntries opens positions with limit orders at the close, paying the
+	// maker fee without slippage. Exits stay market orders, stops must fill.
+	LimitEntries bool `json:"limitEntries"`
+	// SlippageBps is how much worse than the close market orders fill, in
+	// basis points of the price
+	SlippageBps float64 `json:"slippageBps"`
+	// SlippageAtr widens the slippage by that fraction of the ATR, so that it
+	// grows with volatility
+	SlippageAtr float64 `json:"slippageAtr"`
+	// Funding are the funding rates of the asset, sorted by time, applied to
+	// the positions open at each funding time
+	Funding []market.FundingRate `json:"-"`
+}
+
+// CostFlags registers the cost model flags, defaulting to Binance futures
+// regular fees
+func CostFlags() *Costs {
+	c := &Costs{}
+	flag.Float64Var(&c.TakerBps, "taker-bps", 5, "Taker fee in basis points of the notional, paid by market orders")
+	flag.Float64Var(&c.MakerBps, "maker-bps", 2, "Maker fee in basis points of the notional, paid by limit orders")
+	flag.BoolVar(&c.LimitEntries, "limit-entries", false, "Simulate entries as limit orders at the close, paying the maker fee without slippage")
+	flag.Float64Var(&c.SlippageBps, "slippage-bps", 1, "Slippage of market orders in basis points of the price")
+	flag.Float64Var(&c.SlippageAtr, "slippage-atr", 0, "Slippage of market orders added as a fraction of the ATR, for volatility based slippage")
+	return c
+}
+
+// ID identifies the costs, for caches of results depending on them
+func (c Costs) ID() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", c)))
+	return hex.EncodeToString(sum[:])
+}
+
+// entry returns the fill price and the fee of the order opening a position at price
+func (c Costs) entry(posType PositionType, price, atr, quantity float64) (float64, float64) {
+	if c.LimitEntries {
+		return price, price * quantity * c.MakerBps / 10000
+	}
+	return c.market(posType == LONG, price, atr, quantity)
+}
+
+// exit returns the fill price and the fee of the order closing a position at price
+func (c Costs) exit(posType PositionType, price, atr, quantity float64) (float64, float64) {
+	return c.market(posType == SHORT, price, atr, quantity)
+}
+
+// market returns the fill price and the fee of a market order, buying above
+// the price and selling below it
+func (c Costs) market(buy bool, price, atr, quantity float64) (float64, float64) {
+	slippage := price*c.SlippageBps/10000 + atr*c.SlippageAtr
+	if !buy {
+		slippage = -slippage
+	}
+	fill := price + slippage
+	return fill, fill * quantity * c.TakerBps / 10000
+}
+
+// funding returns what a position paid in funding from its entry until exit,
+// negative when it received more than it paid
+func (c Costs) funding(pos Position, exit time.Time) float64 {
+	first, _ := slices.BinarySearchFunc(c.Funding, pos.EntryTime, func(f market.FundingRate, t time.Time) int {
+		// funding at the entry time itself isn't paid
+		if f.Time.After(t) {
+			return 1
+		}
+		return -1
+	})
+
+	var paid float64
+	notional := pos.EntryPrice * pos.Quantity
+	for _, f := range c.Funding[first:] {
+		if f.Time.After(exit) {
+			break
+		}
+		paid += f.Rate * notional
+	}
+
+	if pos.Type == SHORT {
+		return -paid
+	}
+	return paid
+}
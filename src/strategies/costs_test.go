@@ -0,0 +1,75 @@
+package strategies
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+	"pivetta.se/crypro-spotter/src/market"
+)
+
+func TestCosts(t *testing.T) {
+	snapshots := testutil.RandomWalk(3 * 24 * 60)
+	scalp := Scalping{Weights: testWeights, Stabilization: 60, WithSL: true}
+	free := scalp.Backtest(NewSeries(snapshots)).Trades
+
+	costs := Costs{TakerBps: 5, MakerBps: 2, SlippageBps: 1}
+	for at := snapshots[0].Date; at.Before(snapshots[len(snapshots)-1].Date); at = at.Add(8 * time.Hour) {
+		costs.Funding = append(costs.Funding, market.FundingRate{Time: at, Rate: 0.0001})
+	}
+	scalp.Costs = costs
+	paid := scalp.Backtest(NewSeries(snapshots)).Trades
+
+	// costs don't change the decisions, only what each trade makes
+	if len(paid) != len(free) || len(free) == 0 {
+		t.Fatalf("%d trades with costs, %d without", len(paid), len(free))
+	}
+
+	var funded int
+	for i, p := range paid {
+		f := free[i]
+		if !p.EntryTime.Equal(f.EntryTime) || !p.ExitTime.Equal(f.ExitTime) {
+			t.Fatalf("trade %d moved from %v-%v to %v-%v", i, f.EntryTime, f.ExitTime, p.EntryTime, p.ExitTime)
+		}
+
+		entry, exit := f.EntryPrice*1.0001, f.ExitPrice*0.9999
+		sign := 1.0
+		if p.Type == SHORT {
+			entry, exit, sign = f.EntryPrice*0.9999, f.ExitPrice*1.0001, -1
+		}
+		if math.Abs(p.EntryPrice-entry) > 1e-9 || math.Abs(p.ExitPrice-exit) > 1e-9 {
+			t.Fatalf("trade %d filled at %.4f-%.4f, expected %.4f-%.4f", i, p.EntryPrice, p.ExitPrice, entry, exit)
+		}
+		if fees := (entry + exit) * 0.0005; math.Abs(p.Fees-fees) > 1e-9 {
+			t.Fatalf("trade %d paid %.4f fees, expected %.4f", i, p.Fees, fees)
+		}
+
+		var funding float64
+		for _, r := range costs.Funding {
+			if r.Time.After(p.EntryTime) && !r.Time.After(p.ExitTime) {
+				funding += sign * r.Rate * entry
+			}
+		}
+		if math.Abs(p.Funding-funding) > 1e-9 {
+			t.Fatalf("trade %d paid %.4f funding, expected %.4f", i, p.Funding, funding)
+		}
+		if funding != 0 {
+			funded++
+		}
+
+		if pnl := sign*(exit-entry) - p.Fees - p.Funding; math.Abs(p.PnL-pnl) > 1e-9 {
+			t.Fatalf("trade %d made %.4f, expected %.4f", i, p.PnL, pnl)
+		}
+	}
+	if funded == 0 {
+		t.Fatal("no trade was open over a funding time")
+	}
+
+	// limit entries pay the maker fee at the close
+	scalp.Costs = Costs{TakerBps: 5, MakerBps: 2, LimitEntries: true}
+	limit := scalp.Backtest(NewSeries(snapshots)).Trades
+	if l := limit[0]; l.EntryPrice != free[0].EntryPrice || math.Abs(l.Fees-(l.EntryPrice*0.0002+l.ExitPrice*0.0005)) > 1e-9 {
+		t.Fatalf("limit entry filled at %.4f for %.4f fees", l.EntryPrice, l.Fees)
+	}
+}
@@ -0,0 +1,48 @@
+package strategies
+
+import (
+	"math"
+)
+
+// Metrics summarise the performance of a list of trades
+type Metrics struct {
+	Trades       int
+	Wins         int
+	WinRate      float64
+	PnL          float64
+	GrossProfit  float64
+	GrossLoss    float64
+	ProfitFactor float64
+	// MaxDrawdown is the largest drop of the cumulative PnL from its peak
+	MaxDrawdown float64
+}
+
+func Summarize(trades []Trade) Metrics {
+	var m Metrics
+	peak := 0.0
+
+	for _, t := range trades {
+		m.Trades++
+		m.PnL += t.PnL
+		if t.PnL > 0 {
+			m.Wins++
+			m.GrossProfit += t.PnL
+		} else {
+			m.GrossLoss -= t.PnL
+		}
+
+		peak = max(peak, m.PnL)
+		m.MaxDrawdown = max(m.MaxDrawdown, peak-m.PnL)
+	}
+
+	if m.Trades > 0 {
+		m.WinRate = float64(m.Wins) / float64(m.Trades)
+	}
+	if m.GrossLoss > 0 {
+		m.ProfitFactor = m.GrossProfit / m.GrossLoss
+	} else if m.GrossProfit > 0 {
+		m.ProfitFactor = math.Inf(1)
+	}
+
+	return m
+}
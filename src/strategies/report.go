@@ -0,0 +1,125 @@
+package strategies
+
+import (
+	"math"
+	"time"
+
+	"github.com/cinar/indicator/v2/asset"
+)
+
+// EquityPoint is the balance of the account at a time, counting closed trades
+type EquityPoint struct {
+	Date   time.Time
+	Equity float64
+}
+
+// Report is the performance of a backtest over a period, on an account
+type Report struct {
+	Metrics
+	From, To time.Time
+	Ledger   []Trade
+	Equity   []EquityPoint
+	// Return and MaxDrawdownPct are percentages of the starting balance and of
+	// the peak balance before the drawdown
+	Return         float64
+	MaxDrawdownPct float64
+	// Sharpe is the annualised Sharpe ratio of the returns of each bar
+	Sharpe     float64
+	AvgHolding time.Duration
+	// Exposure is the fraction of the period a position was open
+	Exposure float64
+}
+
+// NewReport summarises the trades of a backtest and its equity curve, sampled
+// every interval
+func NewReport(trades []Trade, equity []EquityPoint, interval time.Duration) Report {
+	r := Report{
+		Metrics: Summarize(trades),
+		Ledger:  trades,
+		Equity:  equity,
+	}
+	if len(equity) == 0 {
+		return r
+	}
+	r.From, r.To = equity[0].Date, equity[len(equity)-1].Date
+
+	start := equity[0].Equity
+	if start != 0 {
+		r.Return = (equity[len(equity)-1].Equity/start - 1) * 100
+	}
+
+	peak := start
+	returns := make([]float64, 0, len(equity)-1)
+	for i, p := range equity {
+		peak = max(peak, p.Equity)
+		if peak > 0 {
+			r.MaxDrawdownPct = max(r.MaxDrawdownPct, (peak-p.Equity)/peak*100)
+		}
+		if i > 0 && equity[i-1].Equity != 0 {
+			returns = append(returns, p.Equity/equity[i-1].Equity-1)
+		}
+	}
+
+	mean, std := meanStd(returns)
+	if std > 0 {
+		barsPerYear := float64(365*24*time.Hour) / float64(interval)
+		r.Sharpe = mean / std * math.Sqrt(barsPerYear)
+	}
+
+	var holding time.Duration
+	for _, t := range trades {
+		holding += t.ExitTime.Sub(t.EntryTime)
+	}
+	if len(trades) > 0 {
+		r.AvgHolding = holding / time.Duration(len(trades))
+	}
+	if period := r.To.Sub(r.From); period > 0 {
+		r.Exposure = min(float64(holding)/float64(period), 1)
+	}
+
+	return r
+}
+
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// Resample merges snapshots into candles of the interval, aligned on it
+func Resample(snapshots []*asset.Snapshot, interval time.Duration) []*asset.Snapshot {
+	var candles []*asset.Snapshot
+	var candle *asset.Snapshot
+
+	for _, ss := range snapshots {
+		date := ss.Date.Truncate(interval)
+		if candle == nil || !date.Equal(candle.Date) {
+			candle = &asset.Snapshot{
+				Date: date,
+				Open: ss.Open,
+				High: ss.High,
+				Low:  ss.Low,
+			}
+			candles = append(candles, candle)
+		}
+
+		candle.High = max(candle.High, ss.High)
+		candle.Low = min(candle.Low, ss.Low)
+		candle.Close = ss.Close
+		candle.Volume += ss.Volume
+	}
+
+	return candles
+}
@@ -0,0 +1,61 @@
+package strategies
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+)
+
+func TestResample(t *testing.T) {
+	snapshots := testutil.RandomWalk(60)
+	candles := Resample(snapshots, 15*time.Minute)
+	if len(candles) != 4 {
+		t.Fatalf("got %d candles of 15 minutes out of an hour", len(candles))
+	}
+
+	for i, c := range candles {
+		minutes := snapshots[i*15 : (i+1)*15]
+		high, low := math.Inf(-1), math.Inf(1)
+		for _, ss := range minutes {
+			high, low = max(high, ss.High), min(low, ss.Low)
+		}
+		if !c.Date.Equal(minutes[0].Date) || c.Open != minutes[0].Open || c.Close != minutes[14].Close || c.High != high || c.Low != low || c.Volume != 15 {
+			t.Fatalf("candle %d is %+v", i, c)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	trades := []Trade{
+		{Position: Position{Type: LONG, EntryTime: at(0), EntryPrice: 100, Quantity: 1}, ExitTime: at(10), ExitPrice: 110, PnL: 10},
+		{Position: Position{Type: SHORT, EntryTime: at(20), EntryPrice: 110, Quantity: 1}, ExitTime: at(40), ExitPrice: 130, PnL: -20},
+	}
+	var equity []EquityPoint
+	for i, e := range []float64{1000, 1010, 1010, 990, 990} {
+		equity = append(equity, EquityPoint{Date: at(i * 25), Equity: e})
+	}
+
+	r := NewReport(trades, equity, 25*time.Minute)
+	if r.Trades != 2 || r.WinRate != 0.5 || r.ProfitFactor != 0.5 {
+		t.Fatalf("metrics %+v", r.Metrics)
+	}
+	if math.Abs(r.Return+1) > 1e-9 {
+		t.Fatalf("return %.4f%%, expected -1%%", r.Return)
+	}
+	if math.Abs(r.MaxDrawdownPct-20.0/1010*100) > 1e-9 {
+		t.Fatalf("max drawdown %.4f%%", r.MaxDrawdownPct)
+	}
+	if r.AvgHolding != 15*time.Minute || r.Exposure != 0.3 {
+		t.Fatalf("average holding %v, exposure %.2f", r.AvgHolding, r.Exposure)
+	}
+	if r.Sharpe >= 0 {
+		t.Fatalf("Sharpe %.2f of a losing curve", r.Sharpe)
+	}
+}
@@ -1,16 +1,13 @@
 package strategies
 
 import (
-	"log"
-	"sync"
 	"time"
 
 	"github.com/cinar/indicator/v2/asset"
 	"github.com/cinar/indicator/v2/helper"
-	"github.com/cinar/indicator/v2/momentum"
 	"github.com/cinar/indicator/v2/strategy"
-	"github.com/cinar/indicator/v2/trend"
-	"github.com/cinar/indicator/v2/volatility"
+	"pivetta.se/crypro-spotter/src/indicators"
+	"pivetta.se/crypro-spotter/src/sizing"
 )
 
 type Scalping struct {
@@ -20,6 +17,12 @@ type Scalping struct {
 	CurrentPosition *Position
 	WithSL          bool
 	WithTP          bool
+	// Sizer sizes simulated positions against an account starting at Equity,
+	// without one every position is a single unit
+	Sizer  sizing.Sizer
+	Equity float64
+	// Costs are deducted from simulated trades, none when zero
+	Costs Costs
 }
 
 // TODO: move to a better place
@@ -35,21 +38,19 @@ type Position struct {
 	Type       PositionType
 	EntryPrice float64
 	EntryTime  time.Time
+	Quantity   float64
 }
 
 const Close strategy.Action = 2
 
 type Indicators struct {
-	superTrend <-chan float64
-	upperBand  <-chan float64
-	middleBand <-chan float64
-	lowerBand  <-chan float64
-	ema5       <-chan float64
-	ema20      <-chan float64
-	rsi14      <-chan float64
-	macdLine   <-chan float64
-	macdSignal <-chan float64
-	atr        <-chan float64
+	superTrend *indicators.SuperTrend
+	bollinger  *indicators.BollingerBands
+	emaFast    *indicators.Ema
+	emaSlow    *indicators.Ema
+	rsi        *indicators.Rsi
+	macd       *indicators.Macd
+	atr        *indicators.Atr
 }
 
 type StrategyWeights struct {
@@ -60,6 +61,72 @@ type StrategyWeights struct {
 	MacdWeight        float64 `json:"macdWeight"`
 	StrengthThreshold float64 `json:"strengthThreshold"`
 	AtrMultiplier     float64 `json:"atrMultiplier"`
+
+	// indicator settings, zero values fall back to DefaultWeights
+	EmaFastPeriod        int     `json:"emaFastPeriod,omitempty"`
+	EmaSlowPeriod        int     `json:"emaSlowPeriod,omitempty"`
+	RsiPeriod            int     `json:"rsiPeriod,omitempty"`
+	RsiOverbought        float64 `json:"rsiOverbought,omitempty"`
+	RsiOversold          float64 `json:"rsiOversold,omitempty"`
+	MacdFastPeriod       int     `json:"macdFastPeriod,omitempty"`
+	MacdSlowPeriod       int     `json:"macdSlowPeriod,omitempty"`
+	MacdSignalPeriod     int     `json:"macdSignalPeriod,omitempty"`
+	MacdThreshold        float64 `json:"macdThreshold,omitempty"` // in ATRs, so it means the same on any asset
+	BollingerPeriod      int     `json:"bollingerPeriod,omitempty"`
+	BollingerDeviations  float64 `json:"bollingerDeviations,omitempty"`
+	SuperTrendPeriod     int     `json:"superTrendPeriod,omitempty"`
+	SuperTrendMultiplier float64 `json:"superTrendMultiplier,omitempty"`
+}
+
+// DefaultWeights are the settings of any gene a genome leaves at zero, see the README for old genomes
+var DefaultWeights = StrategyWeights{
+	EmaFastPeriod:        5,
+	EmaSlowPeriod:        20,
+	RsiPeriod:            14,
+	RsiOverbought:        70,
+	RsiOversold:          30,
+	MacdFastPeriod:       12,
+	MacdSlowPeriod:       26,
+	MacdSignalPeriod:     9,
+	MacdThreshold:        0.1,
+	BollingerPeriod:      20,
+	BollingerDeviations:  2,
+	SuperTrendPeriod:     14,
+	SuperTrendMultiplier: 2.5,
+}
+
+// AtrPeriod of the ATR the stop loss and take profit are placed with
+const AtrPeriod = 14
+
+// WithDefaults fills the indicator settings left at zero from DefaultWeights
+func (w StrategyWeights) WithDefaults() StrategyWeights {
+	d := DefaultWeights
+	setInt := func(v *int, def int) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	setFloat := func(v *float64, def float64) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+
+	setInt(&w.EmaFastPeriod, d.EmaFastPeriod)
+	setInt(&w.EmaSlowPeriod, d.EmaSlowPeriod)
+	setInt(&w.RsiPeriod, d.RsiPeriod)
+	setFloat(&w.RsiOverbought, d.RsiOverbought)
+	setFloat(&w.RsiOversold, d.RsiOversold)
+	setInt(&w.MacdFastPeriod, d.MacdFastPeriod)
+	setInt(&w.MacdSlowPeriod, d.MacdSlowPeriod)
+	setInt(&w.MacdSignalPeriod, d.MacdSignalPeriod)
+	setFloat(&w.MacdThreshold, d.MacdThreshold)
+	setInt(&w.BollingerPeriod, d.BollingerPeriod)
+	setFloat(&w.BollingerDeviations, d.BollingerDeviations)
+	setInt(&w.SuperTrendPeriod, d.SuperTrendPeriod)
+	setFloat(&w.SuperTrendMultiplier, d.SuperTrendMultiplier)
+
+	return w
 }
 
 type StrategyParams struct {
@@ -68,9 +135,9 @@ type StrategyParams struct {
 	UpperBand  float64
 	MiddleBand float64
 	LowerBand  float64
-	Ema5       float64
-	Ema20      float64
-	Rsi14      float64
+	EmaFast    float64
+	EmaSlow    float64
+	Rsi        float64
 	MacdLine   float64
 	MacdSignal float64
 	Atr        float64
@@ -80,51 +147,50 @@ func (Scalping) Name() string {
 	return "Scalping"
 }
 
-func (Scalping) getIndicators(snapshots <-chan *asset.Snapshot) Indicators {
-	// init channels
-	ss := helper.Duplicate(snapshots, 3)
-	close := helper.Duplicate(asset.SnapshotsAsClosings(ss[0]), 7)
-	low := helper.Duplicate(asset.SnapshotsAsLows(ss[1]), 2)
-	high := helper.Duplicate(asset.SnapshotsAsHighs(ss[2]), 2)
-
-	// init indicators
-	emaFast := trend.NewEmaWithPeriod[float64](5)
-	emaSlow := trend.NewEmaWithPeriod[float64](20)
-	bollingerBands := volatility.NewBollingerBands[float64]()
-	rsi := momentum.NewRsi[float64]()
-	macd := trend.NewMacd[float64]()
-	superTrend := volatility.NewSuperTrend[float64]()
-	atrInd := volatility.NewAtr[float64]()
-
-	// compute
-	st := superTrend.Compute(high[0], low[0], close[0])
-	atr := atrInd.Compute(high[1], low[1], close[6])
-	upperBand, middleBand, lowerBand := bollingerBands.Compute(close[1])
-	ema5 := emaFast.Compute(close[2])
-	ema20 := emaSlow.Compute(close[3])
-	rsi14 := rsi.Compute(close[4])
-	macdLine, macdSignal := macd.Compute(close[5])
-
-	return Indicators{
-		superTrend: st,
-		upperBand:  upperBand,
-		middleBand: middleBand,
-		lowerBand:  lowerBand,
-		ema5:       ema5,
-		ema20:      ema20,
-		rsi14:      rsi14,
-		macdLine:   macdLine,
-		macdSignal: macdSignal,
-		atr:        atr,
+// getIndicators expects weights with their defaults filled in
+func (s Scalping) getIndicators() *Indicators {
+	w := s.Weights
+	return &Indicators{
+		superTrend: indicators.NewSuperTrend(w.SuperTrendPeriod, w.SuperTrendMultiplier),
+		bollinger:  indicators.NewBollingerBands(w.BollingerPeriod, w.BollingerDeviations),
+		emaFast:    indicators.NewEma(w.EmaFastPeriod),
+		emaSlow:    indicators.NewEma(w.EmaSlowPeriod),
+		rsi:        indicators.NewRsi(w.RsiPeriod),
+		macd:       indicators.NewMacd(w.MacdFastPeriod, w.MacdSlowPeriod, w.MacdSignalPeriod),
+		atr:        indicators.NewAtr(AtrPeriod),
+	}
+}
+
+// next advances every indicator by one snapshot, keeping them all aligned on it
+func (ind *Indicators) next(snapshot *asset.Snapshot) StrategyParams {
+	params := StrategyParams{
+		Snapshot:   *snapshot,
+		SuperTrend: ind.superTrend.Next(snapshot.High, snapshot.Low, snapshot.Close),
+		EmaFast:    ind.emaFast.Next(snapshot.Close),
+		EmaSlow:    ind.emaSlow.Next(snapshot.Close),
+		Rsi:        ind.rsi.Next(snapshot.Close),
+		Atr:        ind.atr.Next(snapshot.High, snapshot.Low, snapshot.Close),
 	}
+	params.UpperBand, params.MiddleBand, params.LowerBand = ind.bollinger.Next(snapshot.Close)
+	params.MacdLine, params.MacdSignal = ind.macd.Next(snapshot.Close)
+
+	return params
+}
+
+// StopDistance is how far from the entry price the stop loss sits
+func (s Scalping) StopDistance(atr float64) float64 {
+	if !s.WithSL {
+		return 0
+	}
+	return s.Weights.AtrMultiplier * atr / 2
 }
 
-func (s *Scalping) decide(params StrategyParams) strategy.Action {
+func (s *Scalping) decide(params StrategyParams) (strategy.Action, ExitReason) {
 	// Initialize signal strength
 	signalStrength := 0.0
-	rsiOverbought := 70.0
-	rsiOversold := 30.0
-	macdThreshold := 0.5
+	rsiOverbought := s.Weights.RsiOverbought
+	rsiOversold := s.Weights.RsiOversold
+	macdThreshold := s.Weights.MacdThreshold * params.Atr
 	// maxStrength := s.Weights.SuperTrendWeight + s.Weights.BollingerWeight + s.Weights.EmaWeight + s.Weights.RsiWeight + s.Weights.MacdWeight
 
 	// check if we have a position and TP and SL levels
@@ -136,14 +202,14 @@ func (s *Scalping) decide(params StrategyParams) strategy.Action {
 
 			if params.Snapshot.Low <= sl {
 				s.CurrentPosition = nil
-				return Close
+				return Close, ExitStopLoss
 			}
 		} else if s.CurrentPosition.Type == SHORT {
 			sl = s.CurrentPosition.EntryPrice + (multi / 2)
 
 			if params.Snapshot.High >= sl {
 				s.CurrentPosition = nil
-				return Close
+				return Close, ExitStopLoss
 			}
 		}
 	}
@@ -154,29 +220,29 @@ func (s *Scalping) decide(params StrategyParams) strategy.Action {
 
 			if params.Snapshot.High >= tp {
 				s.CurrentPosition = nil
-				return Close
+				return Close, ExitTakeProfit
 			}
 		} else if s.CurrentPosition.Type == SHORT {
 			tp = s.CurrentPosition.EntryPrice - multi
 
 			if params.Snapshot.Low <= tp {
 				s.CurrentPosition = nil
-				return Close
+				return Close, ExitTakeProfit
 			}
 		}
 	}
 
 	// EMA Crossover Logic
-	if params.Ema5 > params.Ema20 {
+	if params.EmaFast > params.EmaSlow {
 		signalStrength += s.Weights.EmaWeight // Bullish signal
-	} else if params.Ema5 < params.Ema20 {
+	} else if params.EmaFast < params.EmaSlow {
 		signalStrength -= s.Weights.EmaWeight // Bearish signal
 	}
 
 	// RSI Logic
-	if params.Rsi14 > rsiOverbought {
+	if params.Rsi > rsiOverbought {
 		signalStrength -= s.Weights.RsiWeight // Bearish signal (overbought)
-	} else if params.Rsi14 < rsiOversold {
+	} else if params.Rsi < rsiOversold {
 		signalStrength += s.Weights.RsiWeight // Bullish signal (oversold)
 	}
 
@@ -216,14 +282,14 @@ func (s *Scalping) decide(params StrategyParams) strategy.Action {
 				EntryPrice: params.Snapshot.Close,
 				EntryTime:  params.Snapshot.Date,
 			}
-			return strategy.Buy
+			return strategy.Buy, ""
 		}
 
 		if s.CurrentPosition.Type == SHORT {
 			// log.Printf("Signal Strength: %.2f, confidence: %.2f", signalStrength, signalStrength/maxStrength)
 
 			s.CurrentPosition = nil
-			return Close
+			return Close, ExitSignal
 		}
 	} else if signalStrength < -s.Weights.StrengthThreshold {
 
@@ -234,206 +300,66 @@ func (s *Scalping) decide(params StrategyParams) strategy.Action {
 				EntryPrice: params.Snapshot.Close,
 				EntryTime:  params.Snapshot.Date,
 			}
-			return strategy.Sell
+			return strategy.Sell, ""
 		}
 
 		if s.CurrentPosition.Type == LONG {
 			// log.Printf("Signal Strength: %.2f, confidence: %.2f", signalStrength, signalStrength/maxStrength)
 			s.CurrentPosition = nil
-			return Close
+			return Close, ExitSignal
 		}
 	}
-	return strategy.Hold
+	return strategy.Hold, ""
 }
 
 func (s Scalping) Compute(snapshots <-chan *asset.Snapshot) <-chan strategy.Action {
-	var st, ub, mb, lb, e5, e20, r14, ml, ms, atr float64
-	stable := false
-	ac := make(chan strategy.Action, 50)
-	ss := make(chan *asset.Snapshot, 50)
-	ind := s.getIndicators(ss)
-
-	var wg sync.WaitGroup
-	go func() {
-		for {
-			atr = <-ind.atr
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			st = <-ind.superTrend
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			ub = <-ind.upperBand
-			mb = <-ind.middleBand
-			lb = <-ind.lowerBand
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			e5 = <-ind.ema5
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			e20 = <-ind.ema20
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			r14 = <-ind.rsi14
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			ml = <-ind.macdLine
-			ms = <-ind.macdSignal
-			if stable {
-				wg.Done()
-			}
-		}
-	}()
-
-	go func() {
-		i := 0
-		for snapshot := range snapshots {
-			// log.Printf("Asset: %v, line %d", asset, i)
-			ss <- snapshot
-			wg.Wait()
-
-			// one time stabilization to let all indicators catch up before syncing
-			if !stable && i >= s.Stabilization {
-				time.Sleep(500 * time.Millisecond)
-				stable = true
-				// fmt.Println("Stabilized")
-			}
+	return helper.Map(s.ComputeSignals(snapshots), func(sig Signal) strategy.Action {
+		return sig.Action
+	})
+}
 
-			if i >= s.Stabilization {
-				// log.Printf("SuperTrend: %.2f", st)
-				// log.Printf("UpperBand: %.2f", ub)
-				// log.Printf("MiddleBand: %.2f", mb)
-				// log.Printf("LowerBand: %.2f", lb)
-				// log.Printf("EMA5: %.2f", e5)
-				// log.Printf("EMA20: %.2f", e20)
-				// log.Printf("RSI14: %.2f", r14)
-				// log.Printf("MACDLine: %.2f", ml)
-				// log.Printf("MACDSignal: %.2f", ms)
-
-				action := s.decide(StrategyParams{
-					Snapshot:   *snapshot,
-					SuperTrend: st,
-					UpperBand:  ub,
-					MiddleBand: mb,
-					LowerBand:  lb,
-					Ema5:       e5,
-					Ema20:      e20,
-					Rsi14:      r14,
-					MacdLine:   ml,
-					MacdSignal: ms,
-					Atr:        atr,
-				})
-				ac <- action
-				wg.Add(7)
-			} else {
-				ac <- strategy.Hold
-			}
+// ComputeSignals works like Compute, but also tells why a position was closed.
+// Indicators are advanced in lockstep with the snapshots, once the first
+// Stabilization snapshots have warmed them up each one yields a decision.
+func (s Scalping) ComputeSignals(snapshots <-chan *asset.Snapshot) <-chan Signal {
+	s.Weights = s.Weights.WithDefaults()
+	ind := s.getIndicators()
+	i := 0
 
-			i++
+	return helper.Map(snapshots, func(snapshot *asset.Snapshot) Signal {
+		params := ind.next(snapshot)
+		i++
 
+		if i <= s.Stabilization {
+			return Signal{Action: strategy.Hold}
 		}
-		close(ac)
-	}()
 
-	return ac
+		action, reason := s.decide(params)
+		return Signal{Action: action, Reason: reason, Atr: params.Atr}
+	})
 }
 
 func (s Scalping) ComputeWithOutcome(c <-chan *asset.Snapshot, withLog bool) (<-chan strategy.Action, <-chan float64) {
-	snapshots := helper.Duplicate(c, 2)
-	actions := helper.Duplicate(s.Compute(snapshots[0]), 2)
-
-	high := 0.0
-	low := 0.0
-	position := FLAT
-	entryPrice := 0.0
-	totalDiff := 0.0
-	minutes := 0
-
-	outcomes := helper.Operate(snapshots[1], actions[1], func(ss *asset.Snapshot, action strategy.Action) float64 {
-		close := ss.Close
-		minutes++
-
-		// record high and low of the current position
-		if position != FLAT {
-			if ss.High > high {
-				high = ss.High
-			}
-
-			if ss.Low < low {
-				low = ss.Low
-			}
-		}
+	steps := helper.Duplicate(s.Simulate(c, withLog), 2)
 
-		if position == FLAT {
-			if action == strategy.Buy {
-				position = LONG
-				entryPrice = close
-				high = close
-				low = close
-				minutes = 0
-			} else if action == strategy.Sell {
-				position = SHORT
-				entryPrice = close
-				high = close
-				low = close
-				minutes = 0
-			}
-		} else if position == LONG && action == Close {
-			diff := close - entryPrice
-			totalDiff += diff
-			position = FLAT
-			if withLog {
-				log.Printf("Long position closed. entry: %.2f, exit: %.2f, diff: %.2f, minutes %d, high: %.2f, low: %.2f, total diff: %.2f", entryPrice, close, diff, minutes, high, low, totalDiff)
-			}
+	actions := helper.Map(steps[0], func(st Step) strategy.Action {
+		return st.Action
+	})
+	outcomes := helper.Map(steps[1], func(st Step) float64 {
+		return st.Outcome
+	})
 
-		} else if position == SHORT && action == Close {
-			diff := entryPrice - close
-			totalDiff += diff
-			position = FLAT
-			if withLog {
-				log.Printf("Short position closed. entry: %.2f, exit: %.2f, diff: %.2f, minutes %d, high: %.2f, low: %.2f, total diff: %.2f", entryPrice, close, diff, minutes, high, low, totalDiff)
-			}
-		}
+	return actions, outcomes
+}
 
-		return totalDiff
-	})
+// Simulate trades the strategy over the snapshots and reports every step along
+// with the round-trip trade it closed, if any.
+func (s Scalping) Simulate(c <-chan *asset.Snapshot, withLog bool) <-chan Step {
+	snapshots := helper.Duplicate(c, 2)
+	signals := s.ComputeSignals(snapshots[0])
+	sim := newSimulator(s, withLog)
 
-	return actions[0], outcomes
+	return helper.Operate(snapshots[1], signals, sim.step)
 }
 
 func (s Scalping) Report(c <-chan *asset.Snapshot) *helper.Report {
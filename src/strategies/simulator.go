@@ -0,0 +1,264 @@
+package strategies
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/cinar/indicator/v2/asset"
+	"github.com/cinar/indicator/v2/strategy"
+	"pivetta.se/crypro-spotter/src/indicators"
+	"pivetta.se/crypro-spotter/src/sizing"
+)
+
+// Series is a dataset whose indicators are computed at most once per setting,
+// so that many strategies can be backtested on it without recomputing them.
+// It is safe for concurrent use.
+type Series struct {
+	Snapshots []*asset.Snapshot
+
+	mu      sync.Mutex
+	columns map[columnKey][][]float64
+}
+
+// columnKey identifies an indicator and its settings
+type columnKey struct {
+	name string
+	a, b float64
+	c    int
+}
+
+func NewSeries(snapshots []*asset.Snapshot) *Series {
+	return &Series{
+		Snapshots: snapshots,
+		columns:   map[columnKey][][]float64{},
+	}
+}
+
+// ID is a hash of the snapshots, identifying the dataset whatever it was
+// loaded from
+func (s *Series) ID() string {
+	h := sha256.New()
+	buf := make([]byte, 8)
+	for _, ss := range s.Snapshots {
+		for _, v := range []float64{float64(ss.Date.UnixNano()), ss.Open, ss.High, ss.Low, ss.Close, ss.Volume} {
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+			h.Write(buf)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// column returns the outputs of an indicator over the series, computing them
+// with next on every snapshot the first time they are asked for.
+func (s *Series) column(key columnKey, outputs int, next func(ss *asset.Snapshot, out []float64)) [][]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cols, ok := s.columns[key]; ok {
+		return cols
+	}
+
+	cols := make([][]float64, outputs)
+	for i := range cols {
+		cols[i] = make([]float64, len(s.Snapshots))
+	}
+
+	out := make([]float64, outputs)
+	for i, ss := range s.Snapshots {
+		next(ss, out)
+		for j := range cols {
+			cols[j][i] = out[j]
+		}
+	}
+
+	s.columns[key] = cols
+	return cols
+}
+
+func (s *Series) ema(period int) []float64 {
+	ema := indicators.NewEma(period)
+	return s.column(columnKey{name: "ema", c: period}, 1, func(ss *asset.Snapshot, out []float64) {
+		out[0] = ema.Next(ss.Close)
+	})[0]
+}
+
+func (s *Series) rsi(period int) []float64 {
+	rsi := indicators.NewRsi(period)
+	return s.column(columnKey{name: "rsi", c: period}, 1, func(ss *asset.Snapshot, out []float64) {
+		out[0] = rsi.Next(ss.Close)
+	})[0]
+}
+
+func (s *Series) atr(period int) []float64 {
+	atr := indicators.NewAtr(period)
+	return s.column(columnKey{name: "atr", c: period}, 1, func(ss *asset.Snapshot, out []float64) {
+		out[0] = atr.Next(ss.High, ss.Low, ss.Close)
+	})[0]
+}
+
+func (s *Series) superTrend(period int, multiplier float64) []float64 {
+	st := indicators.NewSuperTrend(period, multiplier)
+	return s.column(columnKey{name: "superTrend", a: multiplier, c: period}, 1, func(ss *asset.Snapshot, out []float64) {
+		out[0] = st.Next(ss.High, ss.Low, ss.Close)
+	})[0]
+}
+
+// bollinger returns the upper, middle and lower bands
+func (s *Series) bollinger(period int, deviations float64) [][]float64 {
+	bb := indicators.NewBollingerBands(period, deviations)
+	return s.column(columnKey{name: "bollinger", a: deviations, c: period}, 3, func(ss *asset.Snapshot, out []float64) {
+		out[0], out[1], out[2] = bb.Next(ss.Close)
+	})
+}
+
+// macd returns the MACD and signal lines
+func (s *Series) macd(fast, slow, signal int) [][]float64 {
+	macd := indicators.NewMacd(fast, slow, signal)
+	return s.column(columnKey{name: "macd", a: float64(fast), b: float64(slow), c: signal}, 2, func(ss *asset.Snapshot, out []float64) {
+		out[0], out[1] = macd.Next(ss.Close)
+	})
+}
+
+// Result of a backtest over a series
+type Result struct {
+	Outcome float64
+	Trades  []Trade
+}
+
+// Backtest trades the strategy over a series, yielding the same trades as
+// Simulate would on its snapshots.
+func (s Scalping) Backtest(series *Series) Result {
+	s.Weights = s.Weights.WithDefaults()
+	w := s.Weights
+	sim := newSimulator(s, false)
+
+	superTrend := series.superTrend(w.SuperTrendPeriod, w.SuperTrendMultiplier)
+	bands := series.bollinger(w.BollingerPeriod, w.BollingerDeviations)
+	emaFast := series.ema(w.EmaFastPeriod)
+	emaSlow := series.ema(w.EmaSlowPeriod)
+	rsi := series.rsi(w.RsiPeriod)
+	macd := series.macd(w.MacdFastPeriod, w.MacdSlowPeriod, w.MacdSignalPeriod)
+	atr := series.atr(AtrPeriod)
+
+	for i, snapshot := range series.Snapshots {
+		sig := Signal{Action: strategy.Hold}
+		if i >= s.Stabilization {
+			action, reason := sim.s.decide(StrategyParams{
+				Snapshot:   *snapshot,
+				SuperTrend: superTrend[i],
+				UpperBand:  bands[0][i],
+				MiddleBand: bands[1][i],
+				LowerBand:  bands[2][i],
+				EmaFast:    emaFast[i],
+				EmaSlow:    emaSlow[i],
+				Rsi:        rsi[i],
+				MacdLine:   macd[0][i],
+				MacdSignal: macd[1][i],
+				Atr:        atr[i],
+			})
+			sig = Signal{Action: action, Reason: reason, Atr: atr[i]}
+		}
+
+		sim.step(snapshot, sig)
+	}
+
+	return Result{
+		Outcome: sim.totalDiff,
+		Trades:  sim.trades,
+	}
+}
+
+// simulator keeps the book of a strategy trading the signals it computes
+type simulator struct {
+	s       *Scalping
+	withLog bool
+
+	pos       *Trade
+	trades    []Trade
+	pnls      []float64
+	high      float64
+	low       float64
+	totalDiff float64
+	minutes   int
+}
+
+func newSimulator(s Scalping, withLog bool) *simulator {
+	return &simulator{s: &s, withLog: withLog}
+}
+
+func (sim *simulator) step(ss *asset.Snapshot, sig Signal) Step {
+	close := ss.Close
+	sim.minutes++
+	step := Step{
+		Snapshot: ss,
+		Action:   sig.Action,
+		Reason:   sig.Reason,
+		Atr:      sig.Atr,
+	}
+
+	// record high and low of the current position
+	if sim.pos != nil {
+		if ss.High > sim.high {
+			sim.high = ss.High
+		}
+
+		if ss.Low < sim.low {
+			sim.low = ss.Low
+		}
+	}
+
+	if sim.pos == nil {
+		if sig.Action == strategy.Buy || sig.Action == strategy.Sell {
+			posType := LONG
+			if sig.Action == strategy.Sell {
+				posType = SHORT
+			}
+
+			quantity := 1.0
+			if sim.s.Sizer != nil {
+				quantity = sim.s.Sizer.Quantity(sizing.Context{
+					Price:        close,
+					Balance:      sim.s.Equity + sim.totalDiff,
+					Atr:          sig.Atr,
+					StopDistance: sim.s.StopDistance(sig.Atr),
+					RecentPnL:    sim.pnls,
+				})
+			}
+
+			if quantity > 0 {
+				price, fee := sim.s.Costs.entry(posType, close, sig.Atr, quantity)
+				sim.pos = &Trade{Position: Position{
+					Type:       posType,
+					EntryTime:  ss.Date,
+					EntryPrice: price,
+					Quantity:   quantity,
+				}, Fees: fee}
+				sim.high = close
+				sim.low = close
+				sim.minutes = 0
+			}
+		}
+	} else if sig.Action == Close {
+		pos := sim.pos
+		price, fee := sim.s.Costs.exit(pos.Type, close, sig.Atr, pos.Quantity)
+		pos.Fees += fee
+		pos.Funding = sim.s.Costs.funding(pos.Position, ss.Date)
+		pos.Close(ss.Date, price, sim.high, sim.low, sig.Reason)
+		sim.totalDiff += pos.PnL
+		sim.pnls = append(sim.pnls, pos.PnL)
+		sim.trades = append(sim.trades, *pos)
+		if sim.withLog {
+			log.Printf("%s position closed. entry: %.2f, exit: %.2f, diff: %.2f, minutes %d, high: %.2f, low: %.2f, reason: %s, total diff: %.2f", pos.Type, pos.EntryPrice, close, pos.PnL, sim.minutes, sim.high, sim.low, pos.ExitReason, sim.totalDiff)
+		}
+
+		step.Trade = pos
+		sim.pos = nil
+	}
+
+	step.Outcome = sim.totalDiff
+	return step
+}
@@ -0,0 +1,67 @@
+package strategies
+
+import (
+	"testing"
+
+	"github.com/cinar/indicator/v2/helper"
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+)
+
+var testWeights = StrategyWeights{
+	SuperTrendWeight:  1,
+	BollingerWeight:   0.5,
+	EmaWeight:         1.5,
+	RsiWeight:         1,
+	MacdWeight:        0.5,
+	StrengthThreshold: 2,
+	AtrMultiplier:     2,
+}
+
+func TestBacktestMatchesSimulate(t *testing.T) {
+	snapshots := testutil.RandomWalk(3 * 24 * 60)
+	scalp := Scalping{Weights: testWeights, Stabilization: 60, WithSL: true}
+
+	var trades []Trade
+	var outcome float64
+	for step := range scalp.Simulate(helper.SliceToChan(snapshots), false) {
+		if step.Trade != nil {
+			trades = append(trades, *step.Trade)
+		}
+		outcome = step.Outcome
+	}
+
+	result := scalp.Backtest(NewSeries(snapshots))
+	if len(trades) == 0 {
+		t.Fatal("expected the strategy to trade")
+	}
+	if result.Outcome != outcome || len(result.Trades) != len(trades) {
+		t.Fatalf("backtest got outcome %v over %d trades, simulate got %v over %d", result.Outcome, len(result.Trades), outcome, len(trades))
+	}
+	for i := range trades {
+		if result.Trades[i] != trades[i] {
+			t.Fatalf("trade %d differs: %+v != %+v", i, result.Trades[i], trades[i])
+		}
+	}
+}
+
+// BenchmarkSimulate is how fitness used to be evaluated, recomputing every
+// indicator through channels for each individual.
+func BenchmarkSimulate(b *testing.B) {
+	snapshots := testutil.RandomWalk(3 * 24 * 60)
+	scalp := Scalping{Weights: testWeights, Stabilization: 60, WithSL: true}
+
+	for i := 0; i < b.N; i++ {
+		for range scalp.Simulate(helper.SliceToChan(snapshots), false) {
+		}
+	}
+}
+
+// BenchmarkBacktest evaluates an individual on indicators computed once per dataset
+func BenchmarkBacktest(b *testing.B) {
+	series := NewSeries(testutil.RandomWalk(3 * 24 * 60))
+	scalp := Scalping{Weights: testWeights, Stabilization: 60, WithSL: true}
+
+	for i := 0; i < b.N; i++ {
+		scalp.Backtest(series)
+	}
+}
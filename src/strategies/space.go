@@ -0,0 +1,98 @@
+package strategies
+
+import (
+	"math"
+	"slices"
+
+	"pivetta.se/crypro-spotter/src/params"
+)
+
+// ScalpingSpace lists every gene of StrategyWeights, named after its JSON field
+// and in the order of StrategyWeights.fields
+var ScalpingSpace = params.Space{
+	{Name: "superTrendWeight", Kind: params.Continuous, Min: 0, Max: 3, Step: 0.5},
+	{Name: "bollingerWeight", Kind: params.Continuous, Min: 0, Max: 3, Step: 0.5},
+	{Name: "emaWeight", Kind: params.Continuous, Min: 0, Max: 3, Step: 0.5},
+	{Name: "rsiWeight", Kind: params.Continuous, Min: 0, Max: 3, Step: 0.5},
+	{Name: "macdWeight", Kind: params.Continuous, Min: 0, Max: 3, Step: 0.5},
+	{Name: "strengthThreshold", Kind: params.Continuous, Min: 0, Max: 10, Step: 0.5},
+	{Name: "atrMultiplier", Kind: params.Continuous, Min: 1.5, Max: 4, Step: 0.5},
+
+	{Name: "emaFastPeriod", Kind: params.Integer, Min: 3, Max: 15},
+	{Name: "emaSlowPeriod", Kind: params.Integer, Min: 16, Max: 50},
+	{Name: "rsiPeriod", Kind: params.Integer, Min: 7, Max: 28},
+	{Name: "rsiOverbought", Kind: params.Continuous, Min: 60, Max: 85, Step: 5},
+	{Name: "rsiOversold", Kind: params.Continuous, Min: 15, Max: 40, Step: 5},
+	{Name: "macdFastPeriod", Kind: params.Integer, Min: 6, Max: 18},
+	{Name: "macdSlowPeriod", Kind: params.Integer, Min: 20, Max: 40},
+	{Name: "macdSignalPeriod", Kind: params.Integer, Min: 5, Max: 14},
+	// in ATRs, starting above 0 as 0 means the default
+	{Name: "macdThreshold", Kind: params.Continuous, Min: 0.05, Max: 1, Step: 0.05},
+	{Name: "bollingerPeriod", Kind: params.Integer, Min: 10, Max: 40},
+	// discrete so that indicators computed once per dataset are shared by many genomes
+	{Name: "bollingerDeviations", Kind: params.Discrete, Choices: []float64{1.5, 1.75, 2, 2.25, 2.5, 2.75, 3}},
+	{Name: "superTrendPeriod", Kind: params.Integer, Min: 7, Max: 28},
+	{Name: "superTrendMultiplier", Kind: params.Discrete, Choices: []float64{1.5, 2, 2.5, 3, 3.5, 4}},
+}
+
+func (Scalping) ParamSpace() params.Space {
+	return ScalpingSpace
+}
+
+// fields points at the field of each gene of ScalpingSpace, in its order
+func (w *StrategyWeights) fields() []any {
+	return []any{
+		&w.SuperTrendWeight,
+		&w.BollingerWeight,
+		&w.EmaWeight,
+		&w.RsiWeight,
+		&w.MacdWeight,
+		&w.StrengthThreshold,
+		&w.AtrMultiplier,
+
+		&w.EmaFastPeriod,
+		&w.EmaSlowPeriod,
+		&w.RsiPeriod,
+		&w.RsiOverbought,
+		&w.RsiOversold,
+		&w.MacdFastPeriod,
+		&w.MacdSlowPeriod,
+		&w.MacdSignalPeriod,
+		&w.MacdThreshold,
+		&w.BollingerPeriod,
+		&w.BollingerDeviations,
+		&w.SuperTrendPeriod,
+		&w.SuperTrendMultiplier,
+	}
+}
+
+// WeightsFromParams decodes a point of ScalpingSpace
+func WeightsFromParams(v []float64) StrategyWeights {
+	var w StrategyWeights
+	v = ScalpingSpace.Clamp(slices.Clone(v))
+	for i, f := range w.fields() {
+		switch f := f.(type) {
+		case *float64:
+			*f = v[i]
+		case *int:
+			*f = int(math.Round(v[i]))
+		}
+	}
+	return w
+}
+
+// Params encodes the weights as a point of ScalpingSpace, settings left to
+// their defaults are filled in
+func (w StrategyWeights) Params() []float64 {
+	w = w.WithDefaults()
+	v := make([]float64, len(ScalpingSpace))
+	for i, f := range w.fields() {
+		switch f := f.(type) {
+		case *float64:
+			v[i] = *f
+		case *int:
+			v[i] = float64(*f)
+		}
+	}
+	return ScalpingSpace.Clamp(v)
+}
@@ -0,0 +1,41 @@
+package strategies
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestSpaceMatchesWeights(t *testing.T) {
+	var w StrategyWeights
+	if len(w.fields()) != len(ScalpingSpace) {
+		t.Fatalf("%d fields for %d genes", len(w.fields()), len(ScalpingSpace))
+	}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 20 {
+		v := ScalpingSpace.Random(r)
+		w := WeightsFromParams(v)
+
+		// each gene lands in the field of its name
+		raw, err := json.Marshal(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]float64
+		err = json.Unmarshal(raw, &m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range ScalpingSpace {
+			if m[p.Name] != v[i] {
+				t.Fatalf("gene %s is %v, decoded as %v", p.Name, v[i], m[p.Name])
+			}
+		}
+
+		if got := w.Params(); !slices.Equal(got, v) {
+			t.Fatalf("point %v encoded back as %v", v, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package strategies
+
+import (
+	"time"
+
+	"github.com/cinar/indicator/v2/asset"
+	"github.com/cinar/indicator/v2/strategy"
+)
+
+type ExitReason string
+
+const (
+	ExitSignal     ExitReason = "signal"
+	ExitStopLoss   ExitReason = "stop_loss"
+	ExitTakeProfit ExitReason = "take_profit"
+	ExitEndOfDay   ExitReason = "end_of_day"
+	ExitRiskHalt   ExitReason = "risk_halt"
+	// ExitError closes the live position of an asset that stops trading on an error
+	ExitError ExitReason = "error"
+)
+
+// Signal is an action along with the reason behind it when it closes a position
+type Signal struct {
+	Action strategy.Action
+	Reason ExitReason
+	Atr    float64
+}
+
+// Step is the state of a simulation after processing one snapshot
+type Step struct {
+	Snapshot *asset.Snapshot
+	Action   strategy.Action
+	Reason   ExitReason
+	Atr      float64
+	Outcome  float64
+	// Trade is set on the step that closes a position
+	Trade *Trade
+}
+
+// Trade is a round trip, from the order opening a position to the one closing it.
+// MAE and MFE are the maximum adverse and favourable price excursions while open.
+type Trade struct {
+	Position
+	ExitTime  time.Time
+	ExitPrice float64
+	PnL       float64
+	Fees      float64
+	// Funding is what the position paid in funding, negative when it received
+	Funding    float64
+	MAE        float64
+	MFE        float64
+	ExitReason ExitReason
+}
+
+func (t PositionType) String() string {
+	switch t {
+	case LONG:
+		return "LONG"
+	case SHORT:
+		return "SHORT"
+	default:
+		return "FLAT"
+	}
+}
+
+// Close fills in the exit of the trade given the highest and lowest prices
+// seen while it was open. Fees and funding must be set beforehand to be deducted
+// from PnL.
+func (t *Trade) Close(date time.Time, price, high, low float64, reason ExitReason) {
+	t.ExitTime = date
+	t.ExitPrice = price
+	t.ExitReason = reason
+
+	if t.Type == LONG {
+		t.PnL = (price - t.EntryPrice) * t.Quantity
+		t.MAE = t.EntryPrice - low
+		t.MFE = high - t.EntryPrice
+	} else {
+		t.PnL = (t.EntryPrice - price) * t.Quantity
+		t.MAE = high - t.EntryPrice
+		t.MFE = t.EntryPrice - low
+	}
+	t.PnL -= t.Fees + t.Funding
+
+	t.MAE = max(t.MAE, 0)
+	t.MFE = max(t.MFE, 0)
+}
+
+// Return is the PnL of the trade as a fraction of its entry notional, comparable
+// across assets whatever their price
+func (t Trade) Return() float64 {
+	notional := t.EntryPrice * t.Quantity
+	if notional == 0 {
+		return 0
+	}
+	return t.PnL / notional
+}
@@ -0,0 +1,161 @@
+package training
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// Fitness scores the trades of a backtest, higher is better
+type Fitness func(trades []strategies.Trade) float64
+
+// deviations and drawdowns are floored at a hundredth of a percent, so that a
+// handful of winning trades doesn't score infinitely
+const minDeviation = 1e-4
+
+// Fitnesses are the fitness functions selectable by name. All but pnl-winrate
+// work on the percentage return of each trade.
+var Fitnesses = map[string]Fitness{
+	"pnl-winrate":     pnlWinRate,
+	"sharpe":          sharpe,
+	"sortino":         sortino,
+	"calmar":          calmar,
+	"profit-factor":   profitFactor,
+	"expectancy":      expectancy,
+	"return-drawdown": returnDrawdown,
+}
+
+// underTraded is the score of a backtest without enough trades, lower than any
+// fitness of a backtest with enough of them, however much it lost
+const underTraded = genetics.Unfit
+
+// NewFitness returns the named fitness function. Backtests with fewer than
+// minTrades trades score underTraded plus their number of trades, below every
+// backtest with enough of them, and the closer to enough the better.
+func NewFitness(name string, minTrades int) (Fitness, error) {
+	f, ok := Fitnesses[name]
+	if !ok {
+		names := make([]string, 0, len(Fitnesses))
+		for n := range Fitnesses {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown fitness %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	return func(trades []strategies.Trade) float64 {
+		if len(trades) < minTrades {
+			return underTraded + float64(len(trades))
+		}
+		return f(trades)
+	}, nil
+}
+
+// pnlWinRate is the original fitness, the PnL in price units times the win rate
+func pnlWinRate(trades []strategies.Trade) float64 {
+	m := strategies.Summarize(trades)
+	return m.PnL * m.WinRate
+}
+
+func returns(trades []strategies.Trade) []float64 {
+	r := make([]float64, len(trades))
+	for i, t := range trades {
+		r[i] = t.Return()
+	}
+	return r
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// sharpe is the mean return per trade over its standard deviation
+func sharpe(trades []strategies.Trade) float64 {
+	r := returns(trades)
+	m := mean(r)
+	var variance float64
+	for _, x := range r {
+		variance += (x - m) * (x - m)
+	}
+	if len(r) > 0 {
+		variance /= float64(len(r))
+	}
+	return m / max(math.Sqrt(variance), minDeviation)
+}
+
+// sortino is like sharpe but only penalises the deviation of losing trades
+func sortino(trades []strategies.Trade) float64 {
+	r := returns(trades)
+	var downside float64
+	for _, x := range r {
+		if x < 0 {
+			downside += x * x
+		}
+	}
+	if len(r) > 0 {
+		downside /= float64(len(r))
+	}
+	return mean(r) / max(math.Sqrt(downside), minDeviation)
+}
+
+// compounded returns the total return of reinvesting in every trade and the
+// largest drop of that equity from its peak, both as fractions
+func compounded(trades []strategies.Trade) (float64, float64) {
+	equity, peak, drawdown := 1.0, 1.0, 0.0
+	for _, t := range trades {
+		equity *= 1 + t.Return()
+		peak = max(peak, equity)
+		drawdown = max(drawdown, (peak-equity)/peak)
+	}
+	return equity - 1, drawdown
+}
+
+// calmar is the return annualised over the time spanned by the trades, over
+// the max drawdown
+func calmar(trades []strategies.Trade) float64 {
+	if len(trades) == 0 {
+		return 0
+	}
+	total, drawdown := compounded(trades)
+	span := trades[len(trades)-1].ExitTime.Sub(trades[0].EntryTime)
+	if span <= 0 {
+		return 0
+	}
+	years := span.Hours() / (365 * 24)
+	return total / years / max(drawdown, minDeviation)
+}
+
+// profitFactor is the sum of the winning returns over the sum of the losing ones
+func profitFactor(trades []strategies.Trade) float64 {
+	var profit, loss float64
+	for _, x := range returns(trades) {
+		if x > 0 {
+			profit += x
+		} else {
+			loss -= x
+		}
+	}
+	return profit / max(loss, minDeviation)
+}
+
+// expectancy is the mean return per trade, in percent
+func expectancy(trades []strategies.Trade) float64 {
+	return mean(returns(trades)) * 100
+}
+
+// returnDrawdown is the compounded return over the max drawdown
+func returnDrawdown(trades []strategies.Trade) float64 {
+	total, drawdown := compounded(trades)
+	return total / max(drawdown, minDeviation)
+}
@@ -0,0 +1,100 @@
+package training
+
+import (
+	"testing"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// trade returns a long trade of one unit entered at 100 and returning pct percent
+func trade(i int, pct float64) strategies.Trade {
+	t := strategies.Trade{
+		Position: strategies.Position{
+			Type:       strategies.LONG,
+			Quantity:   1,
+			EntryTime:  time.Date(2025, 1, 1, i, 0, 0, 0, time.UTC),
+			EntryPrice: 100,
+		},
+	}
+	t.Close(t.EntryTime.Add(30*time.Minute), 100+pct, 100+pct, 100, strategies.ExitSignal)
+	return t
+}
+
+func TestFitnessIsScaleFree(t *testing.T) {
+	trades := []strategies.Trade{trade(0, 1), trade(1, -0.5), trade(2, 2), trade(3, -1)}
+	// the same trades on an asset priced 1000 times higher
+	scaled := make([]strategies.Trade, len(trades))
+	for i, tr := range trades {
+		tr.EntryPrice *= 1000
+		tr.ExitPrice *= 1000
+		tr.PnL *= 1000
+		scaled[i] = tr
+	}
+
+	for name := range Fitnesses {
+		if name == "pnl-winrate" {
+			continue
+		}
+		f, err := NewFitness(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, b := f(trades), f(scaled)
+		if diff := a - b; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: %v on the asset but %v on the scaled one", name, a, b)
+		}
+	}
+}
+
+func TestFitnessPenalisesFewTrades(t *testing.T) {
+	f, err := NewFitness("sharpe", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single lucky trade must rank below a losing genome trading enough
+	lucky := f([]strategies.Trade{trade(0, 5)})
+	losing := f([]strategies.Trade{trade(0, -0.1), trade(1, -0.2), trade(2, 0.1)})
+	if lucky >= losing {
+		t.Errorf("lucky trade scored %v, not below the losing genome's %v", lucky, losing)
+	}
+
+	// a consistently losing genome trading enough must still rank above
+	// one trading too little, for every fitness
+	var losers []strategies.Trade
+	for i := range 10 {
+		losers = append(losers, trade(i, -1))
+	}
+	for name := range Fitnesses {
+		f, err := NewFitness(name, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		few, some := f(losers[:1]), f(losers[:5])
+		if enough := f(losers); enough <= some || some <= few {
+			t.Errorf("%s: losing genome scored %v, not above the under-traded %v and %v", name, enough, some, few)
+		}
+	}
+
+	_, err = NewFitness("unknown", 0)
+	if err == nil {
+		t.Error("unknown fitness gave no error")
+	}
+}
+
+func TestObjectivesPenaliseFewTrades(t *testing.T) {
+	objectives, err := NewObjectives([]string{"sharpe", "trades"}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lucky := []strategies.Trade{trade(0, 5)}
+	losing := []strategies.Trade{trade(0, -0.1), trade(1, -0.2), trade(2, 0.1)}
+	if l, w := objectives[0].score(lucky), objectives[0].score(losing); l >= w {
+		t.Errorf("lucky trade scored %v on sharpe, not below the losing genome's %v", l, w)
+	}
+	if got := objectives[1].score(lucky); got != 1 {
+		t.Errorf("trades objective scored %v, expected the single trade", got)
+	}
+}
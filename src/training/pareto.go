@@ -0,0 +1,193 @@
+package training
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// Objective is one of the goals of a multi-objective training
+type Objective struct {
+	Name string
+	Fn   Fitness
+	// the GA maximises, so objectives to minimise are negated in scores
+	Minimise bool
+}
+
+// Objectives are the objectives selectable by name, every fitness function
+// plus the raw return, drawdown and trade count
+var Objectives = map[string]Objective{
+	"return": {Name: "return", Fn: func(trades []strategies.Trade) float64 {
+		total, _ := compounded(trades)
+		return total * 100
+	}},
+	"drawdown": {Name: "drawdown", Minimise: true, Fn: func(trades []strategies.Trade) float64 {
+		_, drawdown := compounded(trades)
+		return drawdown * 100
+	}},
+	"trades": {Name: "trades", Fn: func(trades []strategies.Trade) float64 {
+		return float64(len(trades))
+	}},
+}
+
+func init() {
+	for name, f := range Fitnesses {
+		Objectives[name] = Objective{Name: name, Fn: f}
+	}
+}
+
+// NewObjectives returns the named objectives. Fitness functions score backtests
+// with fewer than minTrades trades below every other, as they do alone.
+func NewObjectives(names []string, minTrades int) ([]Objective, error) {
+	objectives := make([]Objective, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		o, ok := Objectives[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown objective %q", name)
+		}
+		if _, ok := Fitnesses[name]; ok {
+			var err error
+			o.Fn, err = NewFitness(name, minTrades)
+			if err != nil {
+				return nil, err
+			}
+		}
+		objectives[i] = o
+	}
+	if len(objectives) < 2 {
+		return nil, fmt.Errorf("multi-objective training needs at least 2 objectives, got %d", len(objectives))
+	}
+
+	return objectives, nil
+}
+
+// score is the value of the objective for the GA, which maximises
+func (o Objective) score(trades []strategies.Trade) float64 {
+	if o.Minimise {
+		return -o.Fn(trades)
+	}
+	return o.Fn(trades)
+}
+
+// Values returns the objectives of a score in their own units, e.g. drawdown
+// as a positive percentage
+func Values(objectives []Objective, s genetics.Score) map[string]float64 {
+	values := make(map[string]float64, len(objectives))
+	for i, o := range objectives {
+		v := s.Objectives[i]
+		if o.Minimise {
+			v = -v
+		}
+		values[o.Name] = v
+	}
+	return values
+}
+
+// Constraint bounds an objective of the solutions a Rule may pick
+type Constraint struct {
+	Objective string
+	Op        string
+	Value     float64
+}
+
+func (c Constraint) holds(v float64) bool {
+	switch c.Op {
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	default:
+		return v >= c.Value
+	}
+}
+
+// Rule picks a solution from a Pareto front, the best on one objective among
+// the ones meeting every constraint
+type Rule struct {
+	Best        string
+	Constraints []Constraint
+}
+
+// ParseRule parses the objective to pick the best on and comma separated
+// constraints, e.g. "return" and "drawdown<2,trades>=20"
+func ParseRule(best, constraints string) (Rule, error) {
+	rule := Rule{Best: best}
+	if constraints == "" {
+		return rule, nil
+	}
+
+	for _, c := range strings.Split(constraints, ",") {
+		i := strings.IndexAny(c, "<>")
+		if i <= 0 {
+			return Rule{}, fmt.Errorf("constraint %q is not of the form objective<value", c)
+		}
+
+		op := c[i : i+1]
+		if strings.HasPrefix(c[i+1:], "=") {
+			op += "="
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(c[i+len(op):]), 64)
+		if err != nil {
+			return Rule{}, fmt.Errorf("constraint %q: %w", c, err)
+		}
+
+		rule.Constraints = append(rule.Constraints, Constraint{
+			Objective: strings.TrimSpace(c[:i]),
+			Op:        op,
+			Value:     v,
+		})
+	}
+
+	return rule, nil
+}
+
+// Check returns an error if the rule uses objectives that are not optimised
+func (r Rule) Check(objectives []Objective) error {
+	names := make([]string, len(objectives))
+	for i, o := range objectives {
+		names[i] = o.Name
+	}
+
+	if !slices.Contains(names, r.Best) {
+		return fmt.Errorf("rule picks the best %s, which is not an objective", r.Best)
+	}
+	for _, c := range r.Constraints {
+		if !slices.Contains(names, c.Objective) {
+			return fmt.Errorf("rule constrains %s, which is not an objective", c.Objective)
+		}
+	}
+	return nil
+}
+
+// Pick returns the index of the solution of the front the rule picks
+func (r Rule) Pick(objectives []Objective, front []genetics.Score) (int, error) {
+	err := r.Check(objectives)
+	if err != nil {
+		return 0, fmt.Errorf("pick: %w", err)
+	}
+	best := slices.IndexFunc(objectives, func(o Objective) bool { return o.Name == r.Best })
+
+	picked := -1
+	for i, s := range front {
+		values := Values(objectives, s)
+		allowed := !slices.ContainsFunc(r.Constraints, func(c Constraint) bool {
+			return !c.holds(values[c.Objective])
+		})
+		// scores are maximised, whether the objective is minimised or not
+		if allowed && (picked < 0 || s.Objectives[best] > front[picked].Objectives[best]) {
+			picked = i
+		}
+	}
+
+	if picked < 0 {
+		return 0, fmt.Errorf("pick: none of the %d solutions meets the constraints", len(front))
+	}
+	return picked, nil
+}
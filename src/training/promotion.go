@@ -0,0 +1,74 @@
+package training
+
+import (
+	"fmt"
+
+	"github.com/cinar/indicator/v2/asset"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// Gate holds the thresholds a freshly trained genome must meet on data it was
+// not trained on before it replaces the active one
+type Gate struct {
+	MinTrades       int
+	MinProfitFactor float64
+	// MaxDrawdown is in percent of the price at the start of the holdout
+	MaxDrawdown float64
+	// Costs are deducted from the trades on the holdout
+	Costs strategies.Costs
+}
+
+// Holdout splits the snapshots into a training set and the last minutes held
+// out to validate on. The holdout starts early so that indicators are warm on
+// its first snapshot.
+func Holdout(snapshots []*asset.Snapshot, minutes int) (train, holdout []*asset.Snapshot, err error) {
+	if minutes <= 0 {
+		return nil, nil, fmt.Errorf("holdout: holdout must be positive, got %d minutes", minutes)
+	}
+	if len(snapshots) <= minutes+warmup {
+		return nil, nil, fmt.Errorf("holdout: %d snapshots are not enough for a holdout of %d", len(snapshots), minutes)
+	}
+
+	split := len(snapshots) - minutes
+	return snapshots[:split], snapshots[split-warmup:], nil
+}
+
+// Check backtests the candidate on the holdout, as returned by Holdout, and
+// returns an error explaining why it must not be promoted. When there is an
+// active genome, the candidate must also beat its PnL on the same window.
+func (g Gate) Check(candidate strategies.StrategyWeights, active *strategies.StrategyWeights, holdout []*asset.Snapshot) (strategies.Metrics, error) {
+	series := strategies.NewSeries(holdout)
+	m := backtest(candidate, series, g.Costs)
+
+	if m.Trades < g.MinTrades {
+		return m, fmt.Errorf("%d trades, below the minimum of %d", m.Trades, g.MinTrades)
+	}
+	if m.ProfitFactor < g.MinProfitFactor {
+		return m, fmt.Errorf("profit factor %.2f, below the minimum of %.2f", m.ProfitFactor, g.MinProfitFactor)
+	}
+
+	drawdown := m.MaxDrawdown / holdout[warmup].Close * 100
+	if g.MaxDrawdown > 0 && drawdown > g.MaxDrawdown {
+		return m, fmt.Errorf("max drawdown %.2f%%, above the maximum of %.2f%%", drawdown, g.MaxDrawdown)
+	}
+
+	if active != nil {
+		a := backtest(*active, series, g.Costs)
+		if m.PnL <= a.PnL {
+			return m, fmt.Errorf("PnL %.2f does not beat the active genome's %.2f", m.PnL, a.PnL)
+		}
+	}
+
+	return m, nil
+}
+
+func backtest(weights strategies.StrategyWeights, series *strategies.Series, costs strategies.Costs) strategies.Metrics {
+	scalp := strategies.Scalping{
+		Weights:       weights,
+		Stabilization: warmup,
+		WithSL:        true,
+		Costs:         costs,
+	}
+
+	return strategies.Summarize(scalp.Backtest(series).Trades)
+}
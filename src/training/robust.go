@@ -0,0 +1,145 @@
+package training
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cinar/indicator/v2/asset"
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/params"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// Aggregation combines the fitness of a genome over several datasets into one
+type Aggregation func(values []float64) float64
+
+// NewAggregation returns the aggregation by name: mean, worst, or pN for the
+// Nth percentile, e.g. p25 scores the fitness three datasets out of four beat
+func NewAggregation(name string) (Aggregation, error) {
+	switch {
+	case name == "mean":
+		return func(values []float64) float64 {
+			var sum float64
+			for _, v := range values {
+				sum += v
+			}
+			return sum / float64(len(values))
+		}, nil
+	case name == "worst":
+		return slices.Min[[]float64], nil
+	case strings.HasPrefix(name, "p"):
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err != nil || math.IsNaN(p) || p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentile aggregation %q must be p0 to p100", name)
+		}
+		return func(values []float64) float64 {
+			return percentile(values, p)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q, expected mean, worst or a percentile like p25", name)
+	}
+}
+
+// percentile interpolates the pth percentile of the values
+func percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := min(lo+1, len(sorted)-1)
+	return sorted[lo] + (rank-float64(lo))*(sorted[hi]-sorted[lo])
+}
+
+// RobustFitness checks the named fitness can be compared across assets, which
+// pnl-winrate in price units can't
+func RobustFitness(name string) error {
+	if name == "pnl-winrate" {
+		return fmt.Errorf("fitness %s is in price units, it can't be aggregated over assets", name)
+	}
+	return nil
+}
+
+// Windows splits snapshots into n consecutive windows of equal length, each
+// starting early so that indicators are warm on its first own snapshot
+func Windows(snapshots []*asset.Snapshot, n int) ([][]*asset.Snapshot, error) {
+	length := (len(snapshots) - warmup) / max(n, 1)
+	if n < 1 || length <= 0 {
+		return nil, fmt.Errorf("windows: %d snapshots can't be split in %d windows", len(snapshots), n)
+	}
+
+	windows := make([][]*asset.Snapshot, n)
+	for i := range windows {
+		start := i * length
+		windows[i] = snapshots[start : start+warmup+length]
+	}
+	return windows, nil
+}
+
+// RobustProblem fits the weights of a Scalping strategy over several datasets
+// at once, e.g. several assets or time windows, aggregating their fitness, so
+// that the genome doesn't overfit one of them
+type RobustProblem struct {
+	Series []*strategies.Series
+	// Costs are deducted from the trades on the dataset of the same index,
+	// none when missing
+	Costs []strategies.Costs
+	// Fitness scores the trades on each dataset, sharpe when nil, see
+	// RobustFitness
+	Fitness   Fitness
+	Aggregate Aggregation
+}
+
+func (p *RobustProblem) Space() params.Space {
+	return strategies.Scalping{}.ParamSpace()
+}
+
+func (p *RobustProblem) SetFitness(f Fitness) {
+	p.Fitness = f
+}
+
+func (p *RobustProblem) Dataset() string {
+	ids := make([]string, len(p.Series))
+	for i, series := range p.Series {
+		ids[i] = series.ID() + "|" + p.costs(i).ID()
+	}
+	return strings.Join(ids, ",")
+}
+
+func (p *RobustProblem) Evaluate(individual []float64) genetics.Score {
+	fitness := p.Fitness
+	if fitness == nil {
+		fitness = sharpe
+	}
+	weights := strategies.WeightsFromParams(individual)
+
+	// trades add up over the datasets and the fitness is aggregated. Prices of
+	// different assets don't add up, the PnL is in percent of each dataset's
+	// first close instead.
+	var total genetics.Score
+	values := make([]float64, len(p.Series))
+	for i, series := range p.Series {
+		s := evaluate(weights, series, p.costs(i), fitness, nil)
+		values[i] = s.Value
+		if len(series.Snapshots) > 0 {
+			total.PnL += s.PnL / series.Snapshots[0].Close * 100
+		}
+		total.Successes += s.Successes
+		total.TotalTrades += s.TotalTrades
+	}
+
+	total.Value = p.Aggregate(values)
+	total.Individual = individual
+	return total
+}
+
+// costs of the ith dataset
+func (p *RobustProblem) costs(i int) strategies.Costs {
+	if i < len(p.Costs) {
+		return p.Costs[i]
+	}
+	return strategies.Costs{}
+}
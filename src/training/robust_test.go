@@ -0,0 +1,89 @@
+package training
+
+import (
+	"testing"
+	"time"
+
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+func TestAggregations(t *testing.T) {
+	values := []float64{4, -2, 1, 3, 0}
+	for name, want := range map[string]float64{
+		"mean":  1.2,
+		"worst": -2,
+		"p0":    -2,
+		"p50":   1,
+		"p25":   0,
+		"p100":  4,
+	} {
+		aggregate, err := NewAggregation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := aggregate(values); got < want-1e-9 || got > want+1e-9 {
+			t.Errorf("%s of %v is %v, expected %v", name, values, got, want)
+		}
+	}
+
+	for _, name := range []string{"p101", "pnan", "p-1"} {
+		_, err := NewAggregation(name)
+		if err == nil {
+			t.Errorf("%s gave no error", name)
+		}
+	}
+}
+
+func TestRobustProblemAggregatesWindows(t *testing.T) {
+	snapshots := testutil.RandomWalk(24 * 60)
+	windows, err := Windows(snapshots, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each window picks up where the previous one stopped, after its warmup
+	for i := 1; i < len(windows); i++ {
+		prev := windows[i-1]
+		if !windows[i][warmup].Date.Equal(prev[len(prev)-1].Date.Add(time.Minute)) {
+			t.Fatalf("window %d starts at %v, the previous one ends at %v", i, windows[i][warmup].Date, prev[len(prev)-1].Date)
+		}
+	}
+
+	mean, _ := NewAggregation("mean")
+	worst, _ := NewAggregation("worst")
+	weights := strategies.StrategyWeights{
+		SuperTrendWeight:  1,
+		BollingerWeight:   0.5,
+		EmaWeight:         1.5,
+		RsiWeight:         1,
+		MacdWeight:        0.5,
+		StrengthThreshold: 2,
+		AtrMultiplier:     2,
+	}
+
+	var values []float64
+	var trades int
+	var pnl float64
+	robust := &RobustProblem{Aggregate: mean}
+	for _, w := range windows {
+		series := strategies.NewSeries(w)
+		robust.Series = append(robust.Series, series)
+		s := FitnessFunction(weights, series, strategies.Costs{}, sharpe)
+		values = append(values, s.Value)
+		trades += s.TotalTrades
+		pnl += s.PnL / w[0].Close * 100
+	}
+
+	got := robust.Evaluate(weights.Params())
+	if got.Value != mean(values) || got.TotalTrades != trades {
+		t.Errorf("robust score %+v, expected the mean of %v over %d trades", got, values, trades)
+	}
+	if diff := got.PnL - pnl; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("robust PnL %v, expected %v%% of the prices", got.PnL, pnl)
+	}
+
+	robust.Aggregate = worst
+	if got := robust.Evaluate(weights.Params()); got.Value != worst(values) {
+		t.Errorf("worst score %v, expected the worst of %v", got.Value, values)
+	}
+}
@@ -0,0 +1,105 @@
+// Package training fits strategies to historical data, tying the optimisers
+// to the strategies they optimise.
+package training
+
+import (
+	"fmt"
+
+	"github.com/cinar/indicator/v2/asset"
+	"github.com/cinar/indicator/v2/helper"
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/params"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// ScalpingProblem fits the weights of a Scalping strategy on a dataset
+type ScalpingProblem struct {
+	Series *strategies.Series
+	// Costs are deducted from the trades of each individual
+	Costs strategies.Costs
+	// Fitness scores the trades of each individual, pnl-winrate when nil
+	Fitness Fitness
+	// Objectives are scored too, for multi-objective optimisers
+	Objectives []Objective
+}
+
+func NewScalpingProblem(repo asset.Repository, a string) (*ScalpingProblem, error) {
+	snapshots, err := repo.Get(a)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s data: %v", a, err)
+	}
+
+	// indicators only depend on the data, compute them once for every individual
+	return &ScalpingProblem{
+		Series: strategies.NewSeries(helper.ChanToSlice(snapshots)),
+	}, nil
+}
+
+// FittedProblem is a problem scoring individuals with a fitness function
+type FittedProblem interface {
+	genetics.Problem
+	SetFitness(f Fitness)
+	// Dataset identifies the data individuals are scored on
+	Dataset() string
+}
+
+func (p *ScalpingProblem) SetFitness(f Fitness) {
+	p.Fitness = f
+}
+
+func (p *ScalpingProblem) Dataset() string {
+	return p.Series.ID() + "|" + p.Costs.ID()
+}
+
+func (p *ScalpingProblem) Space() params.Space {
+	return strategies.Scalping{}.ParamSpace()
+}
+
+func (p *ScalpingProblem) Evaluate(individual []float64) genetics.Score {
+	fitness := p.Fitness
+	if fitness == nil {
+		fitness = pnlWinRate
+	}
+	score := evaluate(strategies.WeightsFromParams(individual), p.Series, p.Costs, fitness, p.Objectives)
+	score.Individual = individual
+	return score
+}
+
+func FitnessFunction(weights strategies.StrategyWeights, series *strategies.Series, costs strategies.Costs, fitness Fitness) genetics.Score {
+	return evaluate(weights, series, costs, fitness, nil)
+}
+
+// ScoringVersion is part of the key of cached scores. Bump it whenever how a
+// genome scores changes beside its data, costs and fitness settings, e.g. the
+// simulator, the strategy or the warm-up and stop losses below.
+const ScoringVersion = 2
+
+func evaluate(weights strategies.StrategyWeights, series *strategies.Series, costs strategies.Costs, fitness Fitness, objectives []Objective) genetics.Score {
+	var successes int
+	scalp := strategies.Scalping{
+		Weights:       weights,
+		Stabilization: 60,
+		WithSL:        true,
+		Costs:         costs,
+	}
+
+	result := scalp.Backtest(series)
+	for _, t := range result.Trades {
+		if t.PnL > 0 {
+			successes++
+		}
+	}
+
+	score := genetics.Score{
+		Value:       fitness(result.Trades),
+		PnL:         result.Outcome,
+		Individual:  weights.Params(),
+		Successes:   successes,
+		TotalTrades: len(result.Trades),
+	}
+	for _, o := range objectives {
+		score.Objectives = append(score.Objectives, o.score(result.Trades))
+	}
+
+	return score
+}
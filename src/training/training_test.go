@@ -0,0 +1,39 @@
+package training
+
+import (
+	"slices"
+	"testing"
+
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/lib/testutil"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+func TestRunGeneticIsReproducible(t *testing.T) {
+	snapshots := testutil.RandomWalk(24 * 60)
+	cfg := genetics.DefaultConfig()
+	cfg.PopulationSize = 30
+	cfg.Generations = 5
+	cfg.Seed = 42
+
+	run := func(cfg genetics.Config) *genetics.Score {
+		// a fresh series each time, so nothing is shared between runs but the data
+		best, err := genetics.RunGenetic(&ScalpingProblem{Series: strategies.NewSeries(snapshots)}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return best
+	}
+
+	first := run(cfg)
+	second := run(cfg)
+	if first.Value != second.Value || !slices.Equal(first.Individual, second.Individual) {
+		t.Fatalf("same seed gave different genomes:\n%+v\n%+v", first, second)
+	}
+
+	cfg.Seed = 43
+	other := run(cfg)
+	if slices.Equal(first.Individual, other.Individual) {
+		t.Fatalf("different seeds gave the same genome: %v", first.Individual)
+	}
+}
@@ -0,0 +1,93 @@
+package training
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cinar/indicator/v2/asset"
+	"pivetta.se/crypro-spotter/src/genetics"
+	"pivetta.se/crypro-spotter/src/optimizers"
+	"pivetta.se/crypro-spotter/src/strategies"
+)
+
+// snapshots needed before a window for the indicators to warm up, matching
+// the stabilization FitnessFunction uses
+const warmup = 60
+
+// Fold is one train/test split of a walk-forward run
+type Fold struct {
+	TrainFrom time.Time
+	TestFrom  time.Time
+	TestTo    time.Time
+	Weights   strategies.StrategyWeights
+	InSample  genetics.Score
+	// OutOfSample are the trades of the genome over the test window, which it never saw
+	OutOfSample strategies.Metrics
+	Trades      []strategies.Trade
+}
+
+// WalkForward slides a window of trainDays followed by testDays over the
+// snapshots, training a genome on each train window and backtesting it on the
+// following test window, both paying the costs. The returned metrics aggregate
+// every test window.
+func WalkForward(snapshots []*asset.Snapshot, trainDays, testDays int, cfg genetics.Config, costs strategies.Costs) ([]Fold, strategies.Metrics, error) {
+	trainLen := trainDays * 24 * 60
+	testLen := testDays * 24 * 60
+	if trainLen <= warmup || testLen <= 0 {
+		return nil, strategies.Metrics{}, fmt.Errorf("walkForward: train and test windows must be positive, got %d and %d days", trainDays, testDays)
+	}
+	if len(snapshots) < trainLen+testLen {
+		return nil, strategies.Metrics{}, fmt.Errorf("walkForward: %d snapshots are not enough for a single fold of %d", len(snapshots), trainLen+testLen)
+	}
+
+	fitness, err := NewFitness(cfg.Fitness, cfg.MinTrades)
+	if err != nil {
+		return nil, strategies.Metrics{}, fmt.Errorf("walkForward: %w", err)
+	}
+
+	optimizer, err := optimizers.New(cfg.Optimizer)
+	if err != nil {
+		return nil, strategies.Metrics{}, fmt.Errorf("walkForward: %w", err)
+	}
+
+	var folds []Fold
+	var trades []strategies.Trade
+	for start := 0; start+trainLen+testLen <= len(snapshots); start += testLen {
+		train := snapshots[start : start+trainLen]
+		// the test series starts early so that indicators are warm on its first snapshot
+		test := snapshots[start+trainLen-warmup : start+trainLen+testLen]
+
+		best, err := optimizer.Optimize(&ScalpingProblem{Series: strategies.NewSeries(train), Costs: costs, Fitness: fitness}, cfg)
+		if err != nil {
+			return nil, strategies.Metrics{}, fmt.Errorf("walkForward: %w", err)
+		}
+
+		weights := strategies.WeightsFromParams(best.Individual)
+		scalp := strategies.Scalping{
+			Weights:       weights,
+			Stabilization: warmup,
+			WithSL:        true,
+			Costs:         costs,
+		}
+		result := scalp.Backtest(strategies.NewSeries(test))
+
+		fold := Fold{
+			TrainFrom:   train[0].Date,
+			TestFrom:    test[warmup].Date,
+			TestTo:      test[len(test)-1].Date,
+			Weights:     weights,
+			InSample:    *best,
+			OutOfSample: strategies.Summarize(result.Trades),
+			Trades:      result.Trades,
+		}
+		log.Printf("Fold %d: trained from %s, tested %s to %s: in sample fitness %.2f, out of sample PnL %.2f over %d trades",
+			len(folds), fold.TrainFrom.Format(time.DateTime), fold.TestFrom.Format(time.DateTime), fold.TestTo.Format(time.DateTime),
+			best.Value, fold.OutOfSample.PnL, fold.OutOfSample.Trades)
+
+		folds = append(folds, fold)
+		trades = append(trades, result.Trades...)
+	}
+
+	return folds, strategies.Summarize(trades), nil
+}